@@ -0,0 +1,141 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sync"
+)
+
+// ErrTooManyForbiddenIps is returned when an update of ForbiddenIps would
+// write more entries than Client.MaxForbiddenIps allows.
+var ErrTooManyForbiddenIps = errors.New("too many forbidden IP entries")
+
+// ErrForbiddenIPsConflict is returned when an update of ForbiddenIps kept
+// being overwritten by other writers.
+var ErrForbiddenIPsConflict = errors.New("forbidden IPs changed concurrently")
+
+// forbiddenIPsAttempts bounds the read-modify-write cycles of
+// UpdateForbiddenIPs.
+const forbiddenIPsAttempts = 3
+
+// AddForbiddenIPs blocks the given addresses or CIDRs on an endpoint.
+//
+// The current configuration is read first, the new entries are merged with
+// the existing ForbiddenIps and the result is written back, so blocks added
+// by someone else are kept and the referer control settings are untouched,
+// see UpdateForbiddenIPs for the guarantees.
+func (c *Client) AddForbiddenIPs(ctx context.Context, endpointID string, entries ...string) (resp *http.Response, result *PutAccessControlConfigurationResponse, err error) {
+	add, err := ParseIPList(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.UpdateForbiddenIPs(ctx, endpointID, func(current []netip.Prefix) ([]netip.Prefix, error) {
+		return MergeIPPrefixes(append(current, add...)), nil
+	})
+}
+
+// RemoveForbiddenIPs unblocks the given addresses or CIDRs on an endpoint.
+// Removing part of a blocked range keeps the rest of that range blocked.
+func (c *Client) RemoveForbiddenIPs(ctx context.Context, endpointID string, entries ...string) (resp *http.Response, result *PutAccessControlConfigurationResponse, err error) {
+	remove, err := ParseIPList(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.UpdateForbiddenIPs(ctx, endpointID, func(current []netip.Prefix) ([]netip.Prefix, error) {
+		return SubtractIPPrefixes(current, remove), nil
+	})
+}
+
+// UpdateForbiddenIPs performs a read-modify-write of ForbiddenIps: update is
+// called with the current entries, merged, and returns the entries to write.
+// An error returned by update aborts the update and is returned as is.
+// Existing entries that cannot be parsed are kept as they are.
+//
+// Updates to the same endpoint through this client are serialized. The API
+// has no conditional write, so other processes can still interleave: after a
+// synchronous write the configuration is read back, and when the entries
+// added or removed by update were overwritten the whole cycle is retried,
+// calling update again, up to three times before ErrForbiddenIPsConflict is
+// returned. A change another process writes between our read and our write
+// is lost; it cannot be detected here.
+func (c *Client) UpdateForbiddenIPs(ctx context.Context, endpointID string, update func(current []netip.Prefix) ([]netip.Prefix, error)) (resp *http.Response, result *PutAccessControlConfigurationResponse, err error) {
+	lock, _ := c.accessControlLocks.LoadOrStore(endpointID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	for attempt := 1; ; attempt++ {
+		var added, removed []netip.Prefix
+		if resp, result, added, removed, err = c.writeForbiddenIPs(ctx, endpointID, update); err != nil {
+			return resp, result, err
+		}
+		if c.DryRun != nil || result == nil || result.IsAsync {
+			// Asynchronous writes are not visible yet, nothing to verify.
+			return resp, result, nil
+		}
+		_, current, err := c.GetAccessControlConfiguration(ctx, &GetAccessControlConfigurationRequest{EndpointID: endpointID})
+		if err != nil {
+			return resp, result, fmt.Errorf("verify forbidden IPs: %w", err)
+		}
+		var have []netip.Prefix
+		if current != nil {
+			for _, entry := range current.ForbiddenIps {
+				if p, err := ParseIPPrefix(entry); err == nil {
+					have = append(have, p)
+				}
+			}
+		}
+		stillBlocked := SubtractIPPrefixes(removed, SubtractIPPrefixes(removed, have))
+		if len(SubtractIPPrefixes(added, have)) == 0 && len(stillBlocked) == 0 {
+			return resp, result, nil
+		}
+		if attempt == forbiddenIPsAttempts {
+			return resp, result, fmt.Errorf("%w: update of %s overwritten %d times", ErrForbiddenIPsConflict, endpointID, attempt)
+		}
+	}
+}
+
+// writeForbiddenIPs reads the configuration, applies update and writes it
+// back, returning the prefixes added and removed.
+func (c *Client) writeForbiddenIPs(ctx context.Context, endpointID string, update func([]netip.Prefix) ([]netip.Prefix, error)) (resp *http.Response, result *PutAccessControlConfigurationResponse, added, removed []netip.Prefix, err error) {
+	var current *GetAccessControlConfigurationResponse
+	if resp, current, err = c.GetAccessControlConfiguration(ctx, &GetAccessControlConfigurationRequest{EndpointID: endpointID}); err != nil {
+		return resp, nil, nil, nil, err
+	}
+	if current == nil {
+		current = &GetAccessControlConfigurationResponse{}
+	}
+
+	var (
+		prefixes []netip.Prefix
+		invalid  []string
+	)
+	for _, entry := range current.ForbiddenIps {
+		p, err := ParseIPPrefix(entry)
+		if err != nil {
+			invalid = append(invalid, entry)
+			continue
+		}
+		prefixes = append(prefixes, p)
+	}
+	before := MergeIPPrefixes(prefixes)
+	next, err := update(before)
+	if err != nil {
+		return resp, nil, nil, nil, err
+	}
+	next = MergeIPPrefixes(next)
+	forbiddenIps := append(FormatIPPrefixes(next), invalid...)
+	if c.MaxForbiddenIps > 0 && len(forbiddenIps) > c.MaxForbiddenIps {
+		return resp, nil, nil, nil, fmt.Errorf("%w: %d entries, at most %d allowed", ErrTooManyForbiddenIps, len(forbiddenIps), c.MaxForbiddenIps)
+	}
+
+	body := PutAccessControlConfigurationRequestBody(*current)
+	body.ForbiddenIps = forbiddenIps
+	resp, result, err = c.PutAccessControlConfiguration(ctx, &PutAccessControlConfigurationRequest{
+		EndpointID: endpointID,
+		Body:       body,
+	})
+	return resp, result, SubtractIPPrefixes(next, before), SubtractIPPrefixes(before, next), err
+}
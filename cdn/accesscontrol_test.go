@@ -0,0 +1,119 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// accessControlServer serves the access control of one endpoint. afterPut,
+// when set, may change the stored configuration after each write, playing a
+// concurrent writer.
+type accessControlServer struct {
+	mu       sync.Mutex
+	config   AccessControlConfiguration
+	bodies   []string
+	afterPut func(puts int, config *AccessControlConfiguration)
+}
+
+func (s *accessControlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodPut {
+		body, _ := io.ReadAll(r.Body)
+		s.bodies = append(s.bodies, string(body))
+		s.config = AccessControlConfiguration{}
+		json.Unmarshal(body, &s.config)
+		if s.afterPut != nil {
+			s.afterPut(len(s.bodies), &s.config)
+		}
+		w.Write([]byte(`{"Succeeded": true}`))
+		return
+	}
+	json.NewEncoder(w).Encode(s.config)
+}
+
+func TestPutAccessControlConfigurationBody(t *testing.T) {
+	s := &accessControlServer{}
+	client := newTestClient(t, s)
+	body := PutAccessControlConfigurationRequestBody{ForbiddenIps: []string{"192.0.2.1"}}
+	if _, _, err := client.PutAccessControlConfiguration(context.Background(), &PutAccessControlConfigurationRequest{EndpointID: "ep-1", Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ForbiddenIps":["192.0.2.1"],"RefererControl":{"Enabled":false,"PathPatterns":null,"Referers":null,"RefererControlType":""}}`
+	if len(s.bodies) != 1 || s.bodies[0] != want {
+		t.Errorf("bodies = %q, want %q", s.bodies, want)
+	}
+}
+
+func TestAddForbiddenIPsKeepsOtherSettings(t *testing.T) {
+	s := &accessControlServer{config: AccessControlConfiguration{ForbiddenIps: []string{"192.0.2.0/25", "not-an-ip"}}}
+	s.config.RefererControl.Enabled = true
+	s.config.RefererControl.Referers = []string{"example.com"}
+	client := newTestClient(t, s)
+	if _, _, err := client.AddForbiddenIPs(context.Background(), "ep-1", "192.0.2.128/25", "198.51.100.7"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.0/24", "198.51.100.7", "not-an-ip"}; !reflect.DeepEqual(s.config.ForbiddenIps, want) {
+		t.Errorf("ForbiddenIps = %q, want %q", s.config.ForbiddenIps, want)
+	}
+	if !s.config.RefererControl.Enabled || s.config.RefererControl.Referers[0] != "example.com" {
+		t.Errorf("RefererControl = %+v", s.config.RefererControl)
+	}
+}
+
+func TestUpdateForbiddenIPsRetriesWhenOverwritten(t *testing.T) {
+	s := &accessControlServer{config: AccessControlConfiguration{ForbiddenIps: []string{"192.0.2.1"}}}
+	s.afterPut = func(puts int, config *AccessControlConfiguration) {
+		if puts == 1 {
+			config.ForbiddenIps = []string{"192.0.2.1", "203.0.113.9"}
+		}
+	}
+	client := newTestClient(t, s)
+	if _, _, err := client.AddForbiddenIPs(context.Background(), "ep-1", "198.51.100.7"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.0.2.1", "198.51.100.7", "203.0.113.9"}; !reflect.DeepEqual(s.config.ForbiddenIps, want) {
+		t.Errorf("ForbiddenIps = %q, want %q", s.config.ForbiddenIps, want)
+	}
+	if len(s.bodies) != 2 {
+		t.Errorf("%d writes, want 2", len(s.bodies))
+	}
+
+	s.afterPut = func(puts int, config *AccessControlConfiguration) { config.ForbiddenIps = nil }
+	if _, _, err := client.AddForbiddenIPs(context.Background(), "ep-1", "198.51.100.8"); !errors.Is(err, ErrForbiddenIPsConflict) {
+		t.Errorf("err = %v, want %v", err, ErrForbiddenIPsConflict)
+	}
+}
+
+func TestUpdateForbiddenIPsLimit(t *testing.T) {
+	s := &accessControlServer{}
+	client := newTestClient(t, s)
+	var entries []string
+	for i := 0; i < 1500; i++ {
+		entries = append(entries, fmt.Sprintf("10.%d.%d.1", i/256, i%256))
+	}
+	if _, _, err := client.AddForbiddenIPs(context.Background(), "ep-1", entries...); err != nil {
+		t.Fatalf("unlimited update: %v", err)
+	}
+
+	s = &accessControlServer{}
+	client = newTestClient(t, s)
+	client.MaxForbiddenIps = 1000
+	entries = nil
+	for i := 0; i <= client.MaxForbiddenIps; i++ {
+		entries = append(entries, fmt.Sprintf("10.%d.%d.1", i/256, i%256))
+	}
+	if _, _, err := client.AddForbiddenIPs(context.Background(), "ep-1", entries...); !errors.Is(err, ErrTooManyForbiddenIps) {
+		t.Errorf("err = %v, want %v", err, ErrTooManyForbiddenIps)
+	}
+	if len(s.bodies) != 0 {
+		t.Error("oversized block list written")
+	}
+}
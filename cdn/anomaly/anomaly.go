@@ -0,0 +1,162 @@
+// Package anomaly flags unusual traffic in bandwidth and volume series, such
+// as hotlinking spikes or a collapse of the origin offload.
+//
+// The analyzer works on already fetched series so it can be run against
+// recorded fixtures as well as live data from cdn.Client.QueryBandwidth and
+// cdn.Client.QueryVolume.
+package anomaly
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// Anomaly kind
+type Kind string
+
+const (
+	KindBandwidthSpike      Kind = "BandwidthSpike"      //CDN bandwidth far above its rolling baseline
+	KindOriginBandwidthJump Kind = "OriginBandwidthJump" //Share of bandwidth going back to source jumped, cache misses
+	KindVolumeSpike         Kind = "VolumeSpike"         //CDN traffic far above its rolling baseline
+	KindOriginVolumeJump    Kind = "OriginVolumeJump"    //Share of traffic going back to source jumped, cache misses
+)
+
+type Anomaly struct {
+	Kind       Kind
+	EndpointID string
+	DomainName string
+	Time       time.Time
+	Value      float64 // Observed value, Mbps or MB for spikes, origin ratio for jumps
+	Baseline   float64 // Median of the preceding window
+	Message    string
+}
+
+type Report struct {
+	Anomalies []Anomaly
+}
+
+// Analyzer holds the detection thresholds. The zero value is not useful, use
+// NewAnalyzer for sensible defaults.
+type Analyzer struct {
+	Window      int     // Number of preceding points forming the baseline, DefaultWindow when not positive
+	SpikeFactor float64 // A value above Baseline*SpikeFactor is a spike
+	MinSpike    float64 // Spikes smaller than this absolute increase are ignored
+	RatioJump   float64 // An origin ratio more than this above its baseline is a jump
+	MinVolume   float64 // Points below this CDN value are ignored for ratio jumps
+
+	// OnAnomaly is called for every anomaly found, e.g. to send an alert.
+	OnAnomaly func(Anomaly)
+}
+
+// DefaultWindow is the baseline length used when Analyzer.Window is not
+// positive.
+const DefaultWindow = 12
+
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{
+		Window:      DefaultWindow,
+		SpikeFactor: 3,
+		MinSpike:    10,
+		RatioJump:   0.3,
+		MinVolume:   1,
+	}
+}
+
+// AnalyzeBandwidth scans a bandwidth series.
+func (a *Analyzer) AnalyzeBandwidth(s *cdn.BandwidthSeries) *Report {
+	cdnValues := make([]float64, len(s.Items))
+	originValues := make([]float64, len(s.Items))
+	times := make([]time.Time, len(s.Items))
+	for i, item := range s.Items {
+		times[i] = item.Time
+		cdnValues[i] = float64(item.BandwidthInMbps)
+		originValues[i] = float64(item.OriginBandwidthInMbps)
+	}
+	report := &Report{}
+	a.scan(report, s.EndpointID, s.DomainName, times, cdnValues, originValues, KindBandwidthSpike, KindOriginBandwidthJump, "Mbps")
+	return report
+}
+
+// AnalyzeVolume scans a volume series.
+func (a *Analyzer) AnalyzeVolume(s *cdn.VolumeSeries) *Report {
+	cdnValues := make([]float64, len(s.Items))
+	originValues := make([]float64, len(s.Items))
+	times := make([]time.Time, len(s.Items))
+	for i, item := range s.Items {
+		times[i] = item.Time
+		cdnValues[i] = float64(item.VolumeInMB)
+		originValues[i] = float64(item.OriginVolumeInMB)
+	}
+	report := &Report{}
+	a.scan(report, s.EndpointID, s.DomainName, times, cdnValues, originValues, KindVolumeSpike, KindOriginVolumeJump, "MB")
+	return report
+}
+
+func (a *Analyzer) scan(report *Report, endpointID, domain string, times []time.Time, cdnValues, originValues []float64, spike, jump Kind, unit string) {
+	ratios := make([]float64, len(cdnValues))
+	for i := range cdnValues {
+		if cdnValues[i] > 0 {
+			ratios[i] = originValues[i] / cdnValues[i]
+		}
+	}
+	size := a.Window
+	if size <= 0 {
+		size = DefaultWindow
+	}
+	for i := size; i < len(cdnValues); i++ {
+		baseline := median(cdnValues[i-size : i])
+		if v := cdnValues[i]; v > baseline*a.SpikeFactor && v-baseline >= a.MinSpike {
+			message := fmt.Sprintf("%s %.0f %s is %.1fx the baseline of %.0f %s", domain, v, unit, v/baseline, baseline, unit)
+			if baseline == 0 {
+				message = fmt.Sprintf("%s %.0f %s against a baseline of 0 %s", domain, v, unit, unit)
+			}
+			a.add(report, Anomaly{
+				Kind: spike, EndpointID: endpointID, DomainName: domain, Time: times[i], Value: v, Baseline: baseline,
+				Message: message,
+			})
+		}
+
+		if cdnValues[i] < a.MinVolume {
+			continue
+		}
+		var window []float64
+		for j := i - size; j < i; j++ {
+			if cdnValues[j] >= a.MinVolume {
+				window = append(window, ratios[j])
+			}
+		}
+		if len(window) == 0 {
+			continue
+		}
+		baseline = median(window)
+		if r := ratios[i]; r-baseline > a.RatioJump {
+			a.add(report, Anomaly{
+				Kind: jump, EndpointID: endpointID, DomainName: domain, Time: times[i], Value: r, Baseline: baseline,
+				Message: fmt.Sprintf("%s origin ratio %.0f%% against a baseline of %.0f%%", domain, r*100, baseline*100),
+			})
+		}
+	}
+}
+
+func (a *Analyzer) add(report *Report, anomaly Anomaly) {
+	report.Anomalies = append(report.Anomalies, anomaly)
+	if a.OnAnomaly != nil {
+		a.OnAnomaly(anomaly)
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
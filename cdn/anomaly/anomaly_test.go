@@ -0,0 +1,101 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func readFixture(t *testing.T, name string, v any) {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnalyzeFixtures(t *testing.T) {
+	var bandwidth cdn.BandwidthSeries
+	readFixture(t, "bandwidth_spike.json", &bandwidth)
+	var volume cdn.VolumeSeries
+	readFixture(t, "volume_origin_jump.json", &volume)
+
+	for _, tt := range []struct {
+		name   string
+		report *Report
+		want   []Anomaly
+	}{
+		{"bandwidth spike", NewAnalyzer().AnalyzeBandwidth(&bandwidth), []Anomaly{{
+			Kind: KindBandwidthSpike, Time: time.Date(2023, 3, 1, 1, 40, 0, 0, time.UTC), Value: 480, Baseline: 100,
+		}}},
+		{"origin ratio jump", NewAnalyzer().AnalyzeVolume(&volume), []Anomaly{{
+			Kind: KindOriginVolumeJump, Time: time.Date(2023, 3, 1, 14, 0, 0, 0, time.UTC), Value: 0.634, Baseline: 0.1,
+		}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.report.Anomalies) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", tt.report.Anomalies, tt.want)
+			}
+			for i, got := range tt.report.Anomalies {
+				want := tt.want[i]
+				if got.Kind != want.Kind || !got.Time.Equal(want.Time) || !near(got.Value, want.Value) || !near(got.Baseline, want.Baseline) {
+					t.Errorf("anomaly %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 0.005 && b-a < 0.005
+}
+
+func TestAnalyzeSeriesLength(t *testing.T) {
+	series := func(values ...int64) *cdn.BandwidthSeries {
+		s := &cdn.BandwidthSeries{}
+		for i, v := range values {
+			s.Items = append(s.Items, cdn.BandwidthPoint{Time: time.Unix(int64(i)*300, 0), BandwidthInMbps: v})
+		}
+		return s
+	}
+	for _, tt := range []struct {
+		name   string
+		window int
+		series *cdn.BandwidthSeries
+		want   int
+	}{
+		{"empty", 3, series(), 0},
+		{"shorter than the window", 3, series(10, 500), 0},
+		{"as long as the window", 3, series(10, 10, 500), 0},
+		{"one point after the window", 3, series(10, 10, 10, 500), 1},
+		{"zero baseline", 3, series(0, 0, 0, 500), 1},
+		{"zero window uses the default", 0, series(10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 500), 1},
+		{"negative window uses the default", -1, series(10, 10, 500), 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAnalyzer()
+			a.Window = tt.window
+			if got := a.AnalyzeBandwidth(tt.series).Anomalies; len(got) != tt.want {
+				t.Errorf("got %+v, want %d anomalies", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpikeMessageZeroBaseline(t *testing.T) {
+	a := NewAnalyzer()
+	a.Window = 2
+	report := a.AnalyzeBandwidth(&cdn.BandwidthSeries{DomainName: "a.example.com", Items: []cdn.BandwidthPoint{{}, {}, {BandwidthInMbps: 50}}})
+	if len(report.Anomalies) != 1 {
+		t.Fatalf("got %+v, want one anomaly", report.Anomalies)
+	}
+	if got, want := report.Anomalies[0].Message, "a.example.com 50 Mbps against a baseline of 0 Mbps"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,270 @@
+// Package billing estimates the CDN bill of a subscription from its
+// bandwidth and volume statistics.
+//
+// Three charging models are computed side by side so they can be compared:
+// monthly 95th percentile bandwidth, average daily peak bandwidth and total
+// volume with tiered prices.
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// ChinaStandardTime is the time zone used to split days for the average
+// daily peak model.
+var ChinaStandardTime = time.FixedZone("UTC+8", 8*60*60)
+
+// VolumeTier prices the traffic up to UpToGB at PricePerGB. Tiers are applied
+// progressively in order; UpToGB of 0 means no upper bound.
+type VolumeTier struct {
+	UpToGB     float64
+	PricePerGB float64
+}
+
+// PriceTable holds the unit prices of each charging model.
+type PriceTable struct {
+	Currency                string
+	Percentile95PerMbps     float64 // Monthly price per Mbps of 95th percentile bandwidth
+	AverageDailyPeakPerMbps float64 // Monthly price per Mbps of average daily peak bandwidth
+	VolumeTiers             []VolumeTier
+}
+
+// CostEstimate is the usage and cost of each charging model.
+type CostEstimate struct {
+	Percentile95Mbps     float64
+	AverageDailyPeakMbps float64
+	VolumeGB             float64
+	Percentile95Cost     float64
+	AverageDailyPeakCost float64
+	VolumeCost           float64
+}
+
+type DomainEstimate struct {
+	EndpointID string
+	DomainName string
+	CostEstimate
+}
+
+// Estimate is the bill estimate of a period. Bandwidth models are charged on
+// the subscription-wide series, so domain bandwidth costs do not add up to the
+// subscription cost; they show what each domain would cost on its own.
+type Estimate struct {
+	Currency     string
+	StartTime    time.Time
+	EndTime      time.Time
+	Domains      []DomainEstimate
+	Subscription CostEstimate
+}
+
+// Estimator fetches the statistics of every endpoint of a subscription.
+type Estimator struct {
+	Client *cdn.Client
+	Prices PriceTable
+}
+
+// Estimate lists the endpoints and estimates the bill of the half-open
+// period [start, end), typically a calendar month, so a data point at end
+// belongs to the next period. Endpoints are queried one after another; the
+// windows of each query are fetched concurrently, see
+// cdn.Client.TrafficQueryConcurrency.
+func (e *Estimator) Estimate(ctx context.Context, start, end time.Time) (*Estimate, error) {
+	if err := e.Prices.Validate(); err != nil {
+		return nil, err
+	}
+	_, endpoints, err := e.Client.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []cdn.Endpoint
+	if endpoints != nil {
+		list = *endpoints
+	}
+	bandwidth := make([]*cdn.BandwidthSeries, len(list))
+	volume := make([]*cdn.VolumeSeries, len(list))
+	for i, endpoint := range list {
+		if bandwidth[i], err = e.Client.QueryBandwidth(ctx, &cdn.GetEndpointBandwidthRequest{
+			EndpointId: endpoint.EndpointID,
+			StartTime:  start,
+			EndTime:    end,
+		}); err != nil {
+			return nil, err
+		}
+		if volume[i], err = e.Client.QueryVolume(ctx, &cdn.GetEndpointVolumeRequest{
+			EndpointID:  endpoint.EndpointID,
+			Granularity: cdn.GranularityPerDay,
+			StartTime:   start,
+			EndTime:     end,
+		}); err != nil {
+			return nil, err
+		}
+		if bandwidth[i].DomainName == "" {
+			bandwidth[i].DomainName = endpoint.Settings.CustomDomain
+		}
+		excludeEnd(bandwidth[i], volume[i], end)
+	}
+	estimate := Compute(e.Prices, bandwidth, volume)
+	estimate.StartTime, estimate.EndTime = start.UTC(), end.UTC()
+	return estimate, nil
+}
+
+// excludeEnd drops the points at end, which QueryBandwidth and QueryVolume
+// include, and recomputes the volume totals.
+func excludeEnd(b *cdn.BandwidthSeries, v *cdn.VolumeSeries, end time.Time) {
+	bandwidthItems := b.Items[:0]
+	for _, item := range b.Items {
+		if item.Time.Before(end) {
+			bandwidthItems = append(bandwidthItems, item)
+		}
+	}
+	b.Items = bandwidthItems
+	volumeItems := v.Items[:0]
+	v.TotalCDNVolumeInMB, v.TotalOriginVolumeInMB = 0, 0
+	for _, item := range v.Items {
+		if item.Time.Before(end) {
+			volumeItems = append(volumeItems, item)
+			v.TotalCDNVolumeInMB += item.VolumeInMB
+			v.TotalOriginVolumeInMB += item.OriginVolumeInMB
+		}
+	}
+	v.Items = volumeItems
+}
+
+// Compute estimates the bill from already fetched series. Volume series are
+// matched to bandwidth series by endpoint ID.
+func Compute(prices PriceTable, bandwidth []*cdn.BandwidthSeries, volume []*cdn.VolumeSeries) *Estimate {
+	volumeByEndpoint := map[string]*cdn.VolumeSeries{}
+	for _, v := range volume {
+		volumeByEndpoint[v.EndpointID] = v
+	}
+
+	estimate := &Estimate{Currency: prices.Currency}
+	total := map[time.Time]int64{}
+	for _, b := range bandwidth {
+		domain := DomainEstimate{EndpointID: b.EndpointID, DomainName: b.DomainName}
+		samples := make([]BandwidthSample, 0, len(b.Items))
+		for _, item := range b.Items {
+			samples = append(samples, BandwidthSample{item.Time, item.BandwidthInMbps})
+			total[item.Time] += item.BandwidthInMbps
+		}
+		var volumeMB int64
+		if v := volumeByEndpoint[b.EndpointID]; v != nil {
+			volumeMB = v.TotalCDNVolumeInMB
+		}
+		domain.CostEstimate = prices.cost(samples, volumeMB)
+		estimate.Domains = append(estimate.Domains, domain)
+	}
+
+	samples := make([]BandwidthSample, 0, len(total))
+	for t, mbps := range total {
+		samples = append(samples, BandwidthSample{t, mbps})
+	}
+	var volumeMB int64
+	for _, v := range volume {
+		volumeMB += v.TotalCDNVolumeInMB
+	}
+	estimate.Subscription = prices.cost(samples, volumeMB)
+	return estimate
+}
+
+func (p PriceTable) cost(samples []BandwidthSample, volumeMB int64) CostEstimate {
+	c := CostEstimate{
+		Percentile95Mbps:     Percentile95(samples),
+		AverageDailyPeakMbps: AverageDailyPeak(samples, ChinaStandardTime),
+		VolumeGB:             float64(volumeMB) / 1024,
+	}
+	c.Percentile95Cost = c.Percentile95Mbps * p.Percentile95PerMbps
+	c.AverageDailyPeakCost = c.AverageDailyPeakMbps * p.AverageDailyPeakPerMbps
+	c.VolumeCost = TieredVolumeCost(c.VolumeGB, p.VolumeTiers)
+	return c
+}
+
+var ErrInvalidPriceTable = errors.New("invalid price table")
+
+// Validate checks that prices are not negative and that tier boundaries are
+// ascending, with only the last tier unbounded.
+func (p PriceTable) Validate() error {
+	if p.Percentile95PerMbps < 0 || p.AverageDailyPeakPerMbps < 0 {
+		return fmt.Errorf("%w: negative bandwidth price", ErrInvalidPriceTable)
+	}
+	var lower float64
+	for i, tier := range p.VolumeTiers {
+		if tier.PricePerGB < 0 {
+			return fmt.Errorf("%w: negative price in volume tier %d", ErrInvalidPriceTable, i+1)
+		}
+		last := i == len(p.VolumeTiers)-1
+		if tier.UpToGB == 0 && !last {
+			return fmt.Errorf("%w: only the last volume tier may be unbounded", ErrInvalidPriceTable)
+		}
+		if tier.UpToGB != 0 && tier.UpToGB <= lower {
+			return fmt.Errorf("%w: volume tier %d ends at %g GB, not above %g GB", ErrInvalidPriceTable, i+1, tier.UpToGB, lower)
+		}
+		lower = tier.UpToGB
+	}
+	return nil
+}
+
+type BandwidthSample struct {
+	Time time.Time
+	Mbps int64
+}
+
+// Percentile95 returns the 95th percentile bandwidth: samples are sorted in
+// descending order, the highest 5% are discarded and the next one is billed.
+func Percentile95(samples []BandwidthSample) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	values := make([]int64, len(samples))
+	for i, s := range samples {
+		values[i] = s.Mbps
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] > values[j] })
+	return float64(values[len(values)*5/100])
+}
+
+// AverageDailyPeak returns the mean of the highest sample of each day, days
+// being split in loc.
+func AverageDailyPeak(samples []BandwidthSample, loc *time.Location) float64 {
+	peaks := map[string]int64{}
+	for _, s := range samples {
+		day := s.Time.In(loc).Format("2006-01-02")
+		if peak, ok := peaks[day]; !ok || s.Mbps > peak {
+			peaks[day] = s.Mbps
+		}
+	}
+	if len(peaks) == 0 {
+		return 0
+	}
+	var sum int64
+	for _, peak := range peaks {
+		sum += peak
+	}
+	return float64(sum) / float64(len(peaks))
+}
+
+// TieredVolumeCost prices volumeGB progressively over tiers. Traffic beyond
+// the last bounded tier is charged at the last tier's price.
+func TieredVolumeCost(volumeGB float64, tiers []VolumeTier) float64 {
+	var (
+		cost  float64
+		lower float64
+	)
+	for i, tier := range tiers {
+		if volumeGB <= lower {
+			break
+		}
+		upper := volumeGB
+		if tier.UpToGB > 0 && tier.UpToGB < volumeGB && i < len(tiers)-1 {
+			upper = tier.UpToGB
+		}
+		cost += (upper - lower) * tier.PricePerGB
+		lower = upper
+	}
+	return cost
+}
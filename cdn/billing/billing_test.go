@@ -0,0 +1,138 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func samples(values ...int64) []BandwidthSample {
+	s := make([]BandwidthSample, len(values))
+	for i, v := range values {
+		s[i] = BandwidthSample{time.Unix(int64(i)*300, 0), v}
+	}
+	return s
+}
+
+func TestPercentile95(t *testing.T) {
+	hundred := make([]int64, 100)
+	for i := range hundred {
+		hundred[i] = int64(i + 1) // 1..100
+	}
+	for _, tt := range []struct {
+		name    string
+		samples []BandwidthSample
+		want    float64
+	}{
+		{"empty", nil, 0},
+		{"single", samples(7), 7},
+		{"fewer than twenty", samples(1, 50, 3), 50},
+		{"twenty discards the highest", samples(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 100), 19},
+		{"hundred discards the highest five", samples(hundred...), 95},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Percentile95(tt.samples); got != tt.want {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTieredVolumeCost(t *testing.T) {
+	tiers := []VolumeTier{{UpToGB: 10, PricePerGB: 1}, {UpToGB: 50, PricePerGB: 0.5}, {PricePerGB: 0.25}}
+	for _, tt := range []struct {
+		volumeGB float64
+		want     float64
+	}{
+		{0, 0},
+		{5, 5},
+		{10, 10},
+		{30, 10 + 20*0.5},
+		{50, 10 + 40*0.5},
+		{150, 10 + 40*0.5 + 100*0.25},
+	} {
+		if got := TieredVolumeCost(tt.volumeGB, tiers); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("TieredVolumeCost(%g) = %g, want %g", tt.volumeGB, got, tt.want)
+		}
+	}
+	if got := TieredVolumeCost(100, []VolumeTier{{UpToGB: 10, PricePerGB: 2}}); got != 200 {
+		t.Errorf("volume beyond the last tier: got %g, want 200", got)
+	}
+}
+
+func TestPriceTableValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		tiers []VolumeTier
+		valid bool
+	}{
+		{"no tiers", nil, true},
+		{"ascending", []VolumeTier{{UpToGB: 10}, {UpToGB: 50}, {}}, true},
+		{"descending", []VolumeTier{{UpToGB: 50}, {UpToGB: 10}}, false},
+		{"equal", []VolumeTier{{UpToGB: 10}, {UpToGB: 10}}, false},
+		{"unbounded in the middle", []VolumeTier{{UpToGB: 10}, {}, {UpToGB: 50}}, false},
+		{"negative price", []VolumeTier{{PricePerGB: -1}}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PriceTable{VolumeTiers: tt.tiers}.Validate()
+			if tt.valid && err != nil || !tt.valid && !errors.Is(err, ErrInvalidPriceTable) {
+				t.Errorf("err = %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestEstimateExcludesEnd(t *testing.T) {
+	start := time.Date(2023, 3, 1, 0, 0, 0, 0, ChinaStandardTime)
+	end := start.AddDate(0, 0, 1)
+	stamp := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/endpoints"):
+			fmt.Fprint(w, `[{"EndpointID": "ep-1"}, {"EndpointID": "ep-2"}]`)
+		case strings.HasSuffix(r.URL.Path, "/bandwidth"):
+			json.NewEncoder(w).Encode(map[string]any{"Items": []map[string]any{
+				{"Timestamp": stamp(start), "BandwidthInMbps": 10},
+				{"Timestamp": stamp(end), "BandwidthInMbps": 1000},
+			}})
+		case strings.HasSuffix(r.URL.Path, "/volume"):
+			json.NewEncoder(w).Encode(map[string]any{"Items": []map[string]any{
+				{"Timestamp": stamp(start), "VolumeInMB": 1024},
+				{"Timestamp": stamp(end), "VolumeInMB": 1 << 20},
+			}})
+		}
+	}))
+	defer srv.Close()
+
+	client := cdn.NewClient("id", "key", "sub")
+	client.HTTPClient = srv.Client()
+	client.RestAPIEndpoint = srv.Listener.Addr().String()
+	estimator := &Estimator{
+		Client: client,
+		Prices: PriceTable{Percentile95PerMbps: 1, VolumeTiers: []VolumeTier{{PricePerGB: 1}}},
+	}
+	estimate, err := estimator.Estimate(context.Background(), start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(estimate.Domains) != 2 {
+		t.Fatalf("%d domains, want 2", len(estimate.Domains))
+	}
+	if got := estimate.Subscription; got.Percentile95Mbps != 20 || got.VolumeGB != 2 {
+		t.Errorf("subscription = %+v, want 20 Mbps and 2 GB", got)
+	}
+
+	estimator.Prices.VolumeTiers = []VolumeTier{{UpToGB: 10}, {UpToGB: 5}}
+	if _, err = estimator.Estimate(context.Background(), start, end); !errors.Is(err, ErrInvalidPriceTable) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidPriceTable)
+	}
+}
@@ -0,0 +1,243 @@
+// Package blocklist keeps the ForbiddenIps of CDN endpoints in sync with
+// abusive IP lists published as files or HTTP feeds.
+package blocklist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// Feed format
+type Format string
+
+const (
+	FormatAuto Format = ""     //Detect from file extension, content type or content
+	FormatText Format = "text" //One address or CIDR per line, "#" starts a comment
+	FormatCSV  Format = "csv"  //Comma separated, see Parse for column selection
+	FormatJSON Format = "json" //Array of strings or of objects with an "ip" or "cidr" field
+)
+
+// Source provides a list of addresses and CIDRs to block.
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) ([]netip.Prefix, error)
+}
+
+// FileSource reads a feed from the local filesystem.
+type FileSource struct {
+	Path   string
+	Format Format
+}
+
+func (s FileSource) Name() string { return s.Path }
+
+func (s FileSource) Fetch(ctx context.Context) ([]netip.Prefix, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	format := s.Format
+	if format == FormatAuto {
+		format = formatFromExtension(s.Path)
+	}
+	return Parse(data, format)
+}
+
+// URLSource downloads a feed over HTTP(S).
+type URLSource struct {
+	URL        string
+	Format     Format
+	HTTPClient *http.Client // http.DefaultClient when nil
+}
+
+func (s URLSource) Name() string { return s.URL }
+
+func (s URLSource) Fetch(ctx context.Context) ([]netip.Prefix, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", s.URL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	format := s.Format
+	if format == FormatAuto {
+		format = formatFromContentType(resp.Header.Get("Content-Type"))
+	}
+	if format == FormatAuto {
+		format = formatFromExtension(req.URL.Path)
+	}
+	return Parse(data, format)
+}
+
+// Parse decodes a feed. With FormatAuto the format is guessed from the content.
+//
+// CSV feeds use the column whose header is "ip", "cidr", "address" or
+// "network"; without such a header the first column is used. Entries that
+// fail to parse make the whole feed fail so a corrupt download never shrinks
+// the block list.
+func Parse(data []byte, format Format) ([]netip.Prefix, error) {
+	if format == FormatAuto {
+		format = sniffFormat(data)
+	}
+	var (
+		entries []string
+		err     error
+	)
+	switch format {
+	case FormatText:
+		entries, err = parseText(data)
+	case FormatCSV:
+		entries, err = parseCSV(data)
+	case FormatJSON:
+		entries, err = parseJSON(data)
+	default:
+		return nil, fmt.Errorf("unknown feed format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cdn.ParseIPList(entries)
+}
+
+func parseText(data []byte) ([]string, error) {
+	var entries []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		if fields := strings.Fields(line); len(fields) > 0 {
+			entries = append(entries, fields[0])
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func parseCSV(data []byte) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	column := 0
+header:
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "ip", "cidr", "address", "network":
+			column = i
+			records = records[1:]
+			break header
+		}
+	}
+	var entries []string
+	for _, record := range records {
+		if column < len(record) && strings.TrimSpace(record[column]) != "" {
+			entries = append(entries, record[column])
+		}
+	}
+	return entries, nil
+}
+
+func parseJSON(data []byte) ([]string, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, len(items))
+	for _, item := range items {
+		var s string
+		if err := json.Unmarshal(item, &s); err == nil {
+			entries = append(entries, s)
+			continue
+		}
+		var obj struct {
+			IP      string `json:"ip"`
+			CIDR    string `json:"cidr"`
+			Address string `json:"address"`
+			Network string `json:"network"`
+		}
+		if err := json.Unmarshal(item, &obj); err != nil {
+			return nil, err
+		}
+		switch {
+		case obj.CIDR != "":
+			entries = append(entries, obj.CIDR)
+		case obj.Network != "":
+			entries = append(entries, obj.Network)
+		case obj.IP != "":
+			entries = append(entries, obj.IP)
+		case obj.Address != "":
+			entries = append(entries, obj.Address)
+		default:
+			return nil, fmt.Errorf("JSON feed entry without address: %s", item)
+		}
+	}
+	return entries, nil
+}
+
+func formatFromExtension(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	case ".txt", ".list", ".netset":
+		return FormatText
+	}
+	return FormatAuto
+}
+
+func formatFromContentType(contentType string) Format {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return FormatJSON
+	case strings.Contains(contentType, "csv"):
+		return FormatCSV
+	}
+	return FormatAuto
+}
+
+func sniffFormat(data []byte) Format {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		return FormatJSON
+	}
+	firstLine, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	if bytes.Contains(firstLine, []byte(",")) {
+		return FormatCSV
+	}
+	return FormatText
+}
@@ -0,0 +1,267 @@
+package blocklist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// Syncer keeps the ForbiddenIps of every endpoint in line with the union of
+// its sources. It only adds and removes the entries it owns: entries of the
+// sources are added, and entries it added earlier are removed once no source
+// lists them any more. Blocks added by other means and entries that cannot be
+// parsed are kept, unless a source also lists them, which makes them owned.
+// The referer control settings are left untouched.
+//
+// Updates go through Client.UpdateForbiddenIPs, so they are serialized with
+// AddForbiddenIPs and RemoveForbiddenIPs calls of the same client.
+type Syncer struct {
+	Client      *cdn.Client
+	EndpointIDs []string
+	Sources     []Source
+	AuditLog    io.Writer // Receives one JSON encoded AuditEntry per line, may be nil
+	DryRun      bool      // Compute and audit the delta without calling PutAccessControlConfiguration
+
+	// StateFile remembers the entries owned on each endpoint across
+	// restarts. Without it, entries dropped from the sources while the
+	// syncer was not running stay blocked.
+	StateFile string
+
+	mu    sync.Mutex
+	owned map[string][]netip.Prefix // Endpoint ID -> entries added by the syncer
+}
+
+// ErrEmptySource is returned when a source lists no entries at all, which is
+// far more likely a broken feed than a request to unblock everything.
+var ErrEmptySource = errors.New("source returned no entries")
+
+// AuditEntry records the change applied to one endpoint.
+type AuditEntry struct {
+	Time          time.Time
+	EndpointID    string
+	Added         []string `json:",omitempty"`
+	Removed       []string `json:",omitempty"`
+	Applied       bool
+	CorrelationID string `json:",omitempty"`
+	Error         string `json:",omitempty"`
+}
+
+// Desired fetches all sources and returns the merged block list. A single
+// failing or empty source fails the whole fetch so an unreachable feed never
+// unblocks its addresses.
+func (s *Syncer) Desired(ctx context.Context) ([]netip.Prefix, error) {
+	var all []netip.Prefix
+	for _, source := range s.Sources {
+		prefixes, err := source.Fetch(ctx)
+		if err == nil && len(prefixes) == 0 {
+			err = ErrEmptySource
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s: %w", source.Name(), err)
+		}
+		all = append(all, prefixes...)
+	}
+	return cdn.MergeIPPrefixes(all), nil
+}
+
+// Diff computes the block list replacing current: desired is added, and the
+// entries of owned, the entries added by an earlier sync, that are no longer
+// desired are removed. Only current entries equal to an owned entry are
+// removed, so a wider block added by someone else is never split; other
+// current entries are kept.
+func Diff(current, desired, owned []netip.Prefix) (next []netip.Prefix, added, removed []string) {
+	isOwned := make(map[netip.Prefix]bool, len(owned))
+	for _, p := range owned {
+		isOwned[p] = true
+	}
+	kept := append([]netip.Prefix{}, desired...)
+	for _, p := range current {
+		if !isOwned[p] {
+			kept = append(kept, p)
+		}
+	}
+	next = cdn.MergeIPPrefixes(kept)
+	added = cdn.FormatIPPrefixes(cdn.SubtractIPPrefixes(next, current))
+	removed = cdn.FormatIPPrefixes(cdn.SubtractIPPrefixes(current, next))
+	return next, added, removed
+}
+
+// Sync fetches the sources once and updates every endpoint whose block list
+// differs. Endpoints are processed independently; the returned error
+// summarizes failures, details are in the audit log.
+func (s *Syncer) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadState(); err != nil {
+		return err
+	}
+	desired, err := s.Desired(ctx)
+	if err != nil {
+		return err
+	}
+	if limit, n := s.Client.MaxForbiddenIps, len(cdn.FormatIPPrefixes(desired)); limit > 0 && n > limit {
+		return fmt.Errorf("%w: sources contain %d entries, at most %d allowed",
+			cdn.ErrTooManyForbiddenIps, n, limit)
+	}
+
+	var (
+		failed   int
+		firstErr error
+	)
+	for _, endpointID := range s.EndpointIDs {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = s.syncEndpoint(ctx, endpointID, desired); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	var saveErr error
+	if !s.DryRun {
+		saveErr = s.saveState()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d endpoints failed to sync, first error: %w", failed, len(s.EndpointIDs), firstErr)
+	}
+	if saveErr != nil {
+		return fmt.Errorf("save sync state: %w", saveErr)
+	}
+	return nil
+}
+
+// errNoUpdate aborts UpdateForbiddenIPs when nothing is to be written.
+var errNoUpdate = errors.New("no update")
+
+func (s *Syncer) syncEndpoint(ctx context.Context, endpointID string, desired []netip.Prefix) (err error) {
+	entry := AuditEntry{Time: time.Now().UTC(), EndpointID: endpointID}
+	defer func() {
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if err != nil || len(entry.Added) > 0 || len(entry.Removed) > 0 {
+			s.audit(entry)
+		}
+	}()
+
+	resp, _, err := s.Client.UpdateForbiddenIPs(ctx, endpointID, func(current []netip.Prefix) ([]netip.Prefix, error) {
+		var next []netip.Prefix
+		next, entry.Added, entry.Removed = Diff(current, desired, s.owned[endpointID])
+		if s.DryRun || len(entry.Added) == 0 && len(entry.Removed) == 0 {
+			return nil, errNoUpdate
+		}
+		return next, nil
+	})
+	switch {
+	case err == errNoUpdate:
+		if !s.DryRun {
+			s.owned[endpointID] = desired
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("update access control of %s: %w", endpointID, err)
+	}
+	s.owned[endpointID] = desired
+	entry.Applied = true
+	if resp != nil {
+		entry.CorrelationID = resp.Header.Get("X-Correlation-Id")
+	}
+	return nil
+}
+
+func (s *Syncer) loadState() error {
+	if s.owned != nil {
+		return nil
+	}
+	s.owned = map[string][]netip.Prefix{}
+	if s.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.StateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var state map[string][]string
+	if err = json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("parse %s: %w", s.StateFile, err)
+	}
+	for endpointID, entries := range state {
+		if s.owned[endpointID], err = cdn.ParseIPList(entries); err != nil {
+			return fmt.Errorf("parse %s: %w", s.StateFile, err)
+		}
+	}
+	return nil
+}
+
+func (s *Syncer) saveState() error {
+	if s.StateFile == "" {
+		return nil
+	}
+	state := map[string][]string{}
+	for endpointID, prefixes := range s.owned {
+		state[endpointID] = cdn.FormatIPPrefixes(prefixes)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written next to the state file and renamed over it, so a crash never
+	// leaves a truncated state behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.StateFile), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.StateFile)
+}
+
+func (s *Syncer) audit(entry AuditEntry) {
+	if s.AuditLog == nil {
+		return
+	}
+	line, _ := json.Marshal(entry)
+	_, _ = s.AuditLog.Write(append(line, '\n'))
+}
+
+// Run calls Sync immediately and then every interval until ctx is done.
+// Errors from individual runs are passed to onError, which may be nil.
+// An interval that is not positive is rejected.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid sync interval %v", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
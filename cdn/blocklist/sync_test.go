@@ -0,0 +1,214 @@
+package blocklist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// fakeAccessControl serves the access control API of one endpoint.
+type fakeAccessControl struct {
+	mu     sync.Mutex
+	config cdn.AccessControlConfiguration
+	puts   int
+}
+
+func (f *fakeAccessControl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodPut {
+		body, _ := io.ReadAll(r.Body)
+		f.config = cdn.AccessControlConfiguration{}
+		json.Unmarshal(body, &f.config)
+		f.puts++
+		w.Write([]byte(`{"Succeeded": true}`))
+		return
+	}
+	json.NewEncoder(w).Encode(f.config)
+}
+
+func (f *fakeAccessControl) forbiddenIps() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.config.ForbiddenIps
+}
+
+// newClient returns a client sending its requests to h.
+func newClient(t *testing.T, h http.Handler) *cdn.Client {
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+	client := cdn.NewClient("id", "key", "sub")
+	client.HTTPClient = srv.Client()
+	client.RestAPIEndpoint = srv.Listener.Addr().String()
+	return client
+}
+
+func TestSyncKeepsEntriesItDoesNotOwn(t *testing.T) {
+	api := &fakeAccessControl{config: cdn.AccessControlConfiguration{ForbiddenIps: []string{"192.0.2.1", "not-an-ip"}}}
+
+	var feed string
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, feed)
+	}))
+	defer feedServer.Close()
+
+	client := newClient(t, api)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	newSyncer := func() *Syncer {
+		return &Syncer{
+			Client:      client,
+			EndpointIDs: []string{"ep-1"},
+			Sources:     []Source{URLSource{URL: feedServer.URL + "/feed.txt"}},
+			StateFile:   stateFile,
+		}
+	}
+	syncer := newSyncer()
+	syncAndCheck := func(want ...string) {
+		t.Helper()
+		if err := syncer.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := api.forbiddenIps(); !reflect.DeepEqual(got, want) {
+			t.Errorf("ForbiddenIps = %q, want %q", got, want)
+		}
+	}
+
+	feed = "203.0.113.0/24\n198.51.100.7 # scanner\n"
+	syncAndCheck("192.0.2.1", "198.51.100.7", "203.0.113.0/24", "not-an-ip")
+
+	feed = "203.0.113.0/24\n"
+	syncAndCheck("192.0.2.1", "203.0.113.0/24", "not-an-ip")
+
+	puts := api.puts
+	syncAndCheck("192.0.2.1", "203.0.113.0/24", "not-an-ip")
+	if api.puts != puts {
+		t.Error("unchanged block list written again")
+	}
+
+	// A new syncer knows the entries it owns from the state file.
+	syncer = newSyncer()
+	feed = "198.51.100.0/24\n"
+	syncAndCheck("192.0.2.1", "198.51.100.0/24", "not-an-ip")
+
+	feed = ""
+	if err := syncer.Sync(context.Background()); !errors.Is(err, ErrEmptySource) {
+		t.Errorf("err = %v, want %v", err, ErrEmptySource)
+	}
+	if got, want := api.forbiddenIps(), []string{"192.0.2.1", "198.51.100.0/24", "not-an-ip"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ForbiddenIps = %q after an empty feed, want %q", got, want)
+	}
+}
+
+func TestSyncSerializedWithClientUpdates(t *testing.T) {
+	api := &fakeAccessControl{}
+	client := newClient(t, api)
+	syncer := &Syncer{
+		Client:      client,
+		EndpointIDs: []string{"ep-1"},
+		Sources:     []Source{staticSource{"203.0.113.0/24"}},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := syncer.Sync(context.Background()); err != nil {
+			t.Error(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if _, _, err := client.AddForbiddenIPs(context.Background(), "ep-1", "192.0.2.1"); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+	if got, want := api.forbiddenIps(), []string{"192.0.2.1", "203.0.113.0/24"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ForbiddenIps = %q, want %q", got, want)
+	}
+}
+
+type staticSource []string
+
+func (s staticSource) Name() string { return "static" }
+
+func (s staticSource) Fetch(ctx context.Context) ([]netip.Prefix, error) { return cdn.ParseIPList(s) }
+
+func TestDiff(t *testing.T) {
+	for _, tt := range []struct {
+		name                    string
+		current, desired, owned []string
+		next, added, removed    []string
+	}{
+		{
+			name:    "add desired",
+			current: []string{"192.0.2.1"},
+			desired: []string{"203.0.113.0/24"},
+			next:    []string{"192.0.2.1/32", "203.0.113.0/24"},
+			added:   []string{"203.0.113.0/24"},
+			removed: []string{},
+		},
+		{
+			name:    "remove stale owned",
+			current: []string{"192.0.2.1", "203.0.113.0/24"},
+			desired: []string{"198.51.100.7"},
+			owned:   []string{"203.0.113.0/24"},
+			next:    []string{"192.0.2.1/32", "198.51.100.7/32"},
+			added:   []string{"198.51.100.7"},
+			removed: []string{"203.0.113.0/24"},
+		},
+		{
+			name:    "keep wider block of others",
+			current: []string{"203.0.113.0/24"},
+			desired: []string{"198.51.100.7"},
+			owned:   []string{"203.0.113.9"},
+			next:    []string{"198.51.100.7/32", "203.0.113.0/24"},
+			added:   []string{"198.51.100.7"},
+			removed: []string{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			parse := func(entries []string) []netip.Prefix {
+				prefixes, err := cdn.ParseIPList(entries)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return prefixes
+			}
+			next, added, removed := Diff(parse(tt.current), parse(tt.desired), parse(tt.owned))
+			var nextStrings []string
+			for _, p := range next {
+				nextStrings = append(nextStrings, p.String())
+			}
+			if !reflect.DeepEqual(nextStrings, tt.next) {
+				t.Errorf("next = %q, want %q", nextStrings, tt.next)
+			}
+			if !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("added = %q, want %q", added, tt.added)
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("removed = %q, want %q", removed, tt.removed)
+			}
+		})
+	}
+}
+
+func TestRunRejectsInvalidInterval(t *testing.T) {
+	syncer := &Syncer{Sources: []Source{staticSource{"203.0.113.0/24"}}}
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		if err := syncer.Run(context.Background(), interval, nil); err == nil {
+			t.Errorf("Run(%v) = nil, want an error", interval)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package cassette records the HTTP interactions of a cdn.Client to a file
+// and replays them, so sessions captured once against restapi.cdn.azure.cn
+// can back offline tests:
+//
+//	recorder := cassette.NewRecorder("testdata/list.json", nil)
+//	client.HTTPClient = &http.Client{Transport: recorder}
+//	defer recorder.Save()
+//
+//	replayer, err := cassette.NewReplayer("testdata/list.json")
+//	client.HTTPClient = &http.Client{Transport: replayer}
+//
+// Signatures and the fields of bodies redacted by cdn.RedactJSON, such as
+// private keys, are redacted before anything is written, so cassettes can be
+// committed.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// Redacted replaces the values of RedactedHeaders in cassettes.
+const Redacted = "REDACTED"
+
+// RedactedHeaders are the headers derived from the key value, never written.
+var RedactedHeaders = []string{"Authorization"}
+
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+}
+
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+type Interaction struct {
+	Request  Request
+	Response Response
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []Interaction
+}
+
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to a temporary file first so an interrupted
+// recording never leaves a truncated cassette.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Recorder is an http.RoundTripper sending requests through Transport and
+// recording each interaction in memory. Save writes them to the cassette at
+// Path.
+type Recorder struct {
+	Path      string
+	Transport http.RoundTripper // http.DefaultTransport when nil
+
+	// Redact, when set, is called on each interaction after RedactedHeaders
+	// are removed, to hide more data such as subscription IDs.
+	Redact func(*Interaction)
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a recorder starting an empty cassette at path.
+func NewRecorder(path string, transport http.RoundTripper) *Recorder {
+	return &Recorder{Path: path, Transport: transport}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, req, err := requestBody(req)
+	if err != nil {
+		req.Body.Close()
+		return nil, err
+	}
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+			Body:   string(cdn.RedactJSON(reqBody)),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+			Body:       string(cdn.RedactJSON(respBody)),
+		},
+	}
+	if r.Redact != nil {
+		r.Redact(&interaction)
+	}
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Save writes the interactions recorded so far to Path.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.cassette.Save(r.Path); err != nil {
+		return fmt.Errorf("save cassette: %w", err)
+	}
+	return nil
+}
+
+// requestBody returns the body of req without modifying req, as required
+// from a RoundTripper. With GetBody set the body is read from a copy; else
+// it is consumed and closed, and the returned clone of req carries it
+// instead.
+func requestBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, req, err
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		return data, req, err
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, req, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(data))
+	return data, clone, nil
+}
+
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range RedactedHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, Redacted)
+		}
+	}
+	return h
+}
+
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+// Replayer is an http.RoundTripper answering requests from a cassette
+// without network access. A request matches an interaction with the same
+// method, path, query and body; bodies are compared as JSON when they parse,
+// with secrets redacted as in recordings.
+// Headers, including the volatile x-azurecdn-request-date, and the host are
+// ignored. Each interaction answers once, in recorded order, so repeated
+// requests get the successive recorded responses.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+func NewReplayer(path string) (*Replayer, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayerFromCassette(c), nil
+}
+
+func NewReplayerFromCassette(c *Cassette) *Replayer {
+	return &Replayer{interactions: c.Interactions, used: make([]bool, len(c.Interactions))}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _, err := requestBody(req)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := requestKey(req.Method, req.URL, string(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] {
+			continue
+		}
+		u, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("cassette interaction %d: %w", i, err)
+		}
+		if requestKey(interaction.Request.Method, u, interaction.Request.Body) != key {
+			continue
+		}
+		r.used[i] = true
+		header := interaction.Response.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.RequestURI())
+}
+
+// Remaining returns the number of interactions not replayed yet, so tests
+// can check that every recorded request was made.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, used := range r.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+func requestKey(method string, u *url.URL, body string) string {
+	return method + " " + u.EscapedPath() + "?" + u.Query().Encode() + "\n" + normalizeBody(body)
+}
+
+// normalizeBody re-encodes JSON bodies, which sorts object keys and drops
+// insignificant whitespace, and redacts them.
+func normalizeBody(body string) string {
+	var v any
+	if err := json.Unmarshal(cdn.RedactJSON([]byte(body)), &v); err != nil {
+		return strings.TrimSpace(body)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return strings.TrimSpace(body)
+	}
+	return string(data)
+}
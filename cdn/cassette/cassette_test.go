@@ -0,0 +1,99 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func TestReplaySession(t *testing.T) {
+	replayer, err := NewReplayer("testdata/session.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := cdn.NewClient("id", "key", "00000000-0000-0000-0000-000000000000")
+	client.HTTPClient = &http.Client{Transport: replayer}
+
+	_, endpoints, err := client.ListEndpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*endpoints) != 1 || (*endpoints)[0].Settings.CustomDomain != "static.example.com" {
+		t.Fatalf("endpoints = %+v", *endpoints)
+	}
+	resp, purge, err := client.AddPurge(context.Background(), &cdn.AddPurgeRequest{
+		EndpointID: (*endpoints)[0].EndpointID,
+		Body:       cdn.AddPurgeRequestBody{Files: []string{"http://static.example.com/pictures/city.png"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purge.AsyncInfo.TaskTrackId != "2c9e1f7a-0000-0000-0000-000000000002" {
+		t.Errorf("TaskTrackId = %s", purge.AsyncInfo.TaskTrackId)
+	}
+	if got := resp.Header.Get("X-Correlation-Id"); got != "0b7d3e52-44a9-4d0e-b1f3-5d6c8e9a2f34" {
+		t.Errorf("X-Correlation-Id = %s", got)
+	}
+	if n := replayer.Remaining(); n != 0 {
+		t.Errorf("%d interactions not replayed", n)
+	}
+	if _, _, err = client.ListEndpoints(context.Background()); err == nil {
+		t.Error("interaction replayed twice")
+	}
+}
+
+func TestRecorderDoesNotModifyRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	recorder := NewRecorder(path, nil)
+	for _, newBody := range []func(s string) io.Reader{
+		func(s string) io.Reader { return strings.NewReader(s) },               // GetBody set
+		func(s string) io.Reader { return io.NopCloser(strings.NewReader(s)) }, // No GetBody
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/echo", newBody(`{"PrivateKey":"secret"}`))
+		req.Header.Set("Authorization", "AzureCDN id:signature")
+		body := req.Body
+		resp, err := recorder.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		if string(got) != `{"PrivateKey":"secret"}` {
+			t.Errorf("response body = %s", got)
+		}
+		if req.Body != body {
+			t.Error("request body replaced")
+		}
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Interactions) != 2 {
+		t.Fatalf("%d interactions, want 2", len(c.Interactions))
+	}
+	for _, interaction := range c.Interactions {
+		if interaction.Request.Header.Get("Authorization") != Redacted {
+			t.Errorf("Authorization = %s", interaction.Request.Header.Get("Authorization"))
+		}
+		if bytes.Contains([]byte(interaction.Request.Body+interaction.Response.Body), []byte("secret")) {
+			t.Errorf("private key recorded: %+v", interaction)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package cdn
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -12,62 +13,162 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-func NewClient(keyID string, keyValue string, subscriptionID string) *Client {
+// NewClient returns a client with its own connection pool, see Option for
+// the defaults.
+func NewClient(keyID string, keyValue string, subscriptionID string, opts ...Option) *Client {
+	o := &clientOptions{timeout: DefaultTimeout, endpoint: "restapi.cdn.azure.cn"}
+	for _, opt := range opts {
+		opt(o)
+	}
 	return &Client{
-		RestAPIEndpoint: "restapi.cdn.azure.cn",
-		HTTPClient:      http.DefaultClient,
+		RestAPIEndpoint: o.endpoint,
+		HTTPClient:      o.buildHTTPClient(),
+		UserAgent:       o.userAgent,
+		Instrumentation: o.instrumentation,
+		Logger:          o.logger,
 		KeyID:           keyID,
-		KeyValue:        keyValue,
+		KeyValue:        Secret(keyValue),
 		SubscriptionID:  subscriptionID,
 	}
 }
 
+// Client calls the CDN REST API. A Client is safe for concurrent use by
+// multiple goroutines and should be reused, so its connections are. Its
+// fields must not be modified once requests have started.
 type Client struct {
-	HTTPClient      *http.Client
-	RestAPIEndpoint string
-	SubscriptionID  string
-	KeyID           string
-	KeyValue        string
+	HTTPClient              *http.Client
+	RestAPIEndpoint         string // API host, or base URL when it has a scheme
+	UserAgent               string
+	SubscriptionID          string
+	KeyID                   string
+	KeyValue                Secret
+	Credentials             CredentialProvider            // Supplies the key pair per request instead of KeyID and KeyValue when set
+	MaxForbiddenIps         int                           // Caps the ForbiddenIps written by UpdateForbiddenIPs, no limit when zero
+	TrafficCache            TrafficCache                  // Optional store for closed traffic windows, see QueryBandwidth
+	MaxTrafficQueryRange    map[Granularity]time.Duration // Overrides DefaultMaxTrafficQueryRange per granularity
+	TrafficQueryConcurrency int                           // Windows fetched at the same time, DefaultTrafficQueryConcurrency when zero
+	TrafficCacheSettleDelay time.Duration                 // Age of a closed window, DefaultTrafficCacheSettleDelay when zero
+	DryRun                  io.Writer                     // When set, mutating requests are printed here instead of sent, see Request
+	RateLimiter             *RateLimiter                  // Optional budgets delaying requests, see RateLimiter
+	ClockSkewThreshold      time.Duration                 // Skew from which rejected requests are blamed on the clock, DefaultClockSkewThreshold when zero
+	Instrumentation         Instrumentation               // Optional tracing and metrics hook, see Instrumentation
+	Logger                  Logger                        // Optional, receives each request and response at debug level
+
+	accessControlLocks sync.Map // endpoint ID -> *sync.Mutex guarding ForbiddenIps updates
+	clock              clock
 }
 
 func (c *Client) MakeRequestUrl(path string, query url.Values) url.URL {
-	if query == nil {
-		query = url.Values{}
+	base := c.RestAPIEndpoint
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
 	}
-	u, _ := url.Parse(fmt.Sprintf("https://%s/subscriptions/%s%s", c.RestAPIEndpoint, c.SubscriptionID, path))
-	for k, v := range u.Query() {
-		query[k] = v
+	u, _ := url.Parse(fmt.Sprintf("%s/subscriptions/%s%s", strings.TrimSuffix(base, "/"), c.SubscriptionID, path))
+	values := u.Query()
+	for k, v := range query {
+		values[k] = v
 	}
+	u.RawQuery = values.Encode()
 	return *u
 }
 
-func (c *Client) Request(method string, uri url.URL, body []byte, result any) (resp *http.Response, err error) {
+// Request signs and sends a request, decoding the JSON response into result.
+// ctx bounds the request, including rate limiting and retries, and is passed
+// to Instrumentation and the transport.
+//
+// With DryRun set, requests other than GET are written to DryRun with the
+// signature redacted, and a successful TaskResponse is decoded into result
+// instead. GET requests are still sent, so helpers reading the current state
+// before updating it print the update they would really make.
+//
+// When the API rejects the signature and the Date of its response shows that
+// the local clock is off by more than Client.ClockSkewThreshold, the clock
+// offset is corrected, see ClockSkew. Idempotent requests are then signed and
+// sent once more, through the RateLimiter; others fail and only later
+// requests use the corrected offset.
+func (c *Client) Request(ctx context.Context, method string, uri url.URL, body []byte, result any) (resp *http.Response, err error) {
+	dryRun := c.DryRun != nil && method != http.MethodGet
+	if c.Instrumentation != nil && !dryRun {
+		start := time.Now()
+		var end func(OperationResult)
+		ctx, end = c.Instrumentation.StartOperation(ctx, operationOf(method, uri.Path))
+		defer func() {
+			result := OperationResult{ErrorType: ErrorType(resp, err), Err: err, Duration: time.Since(start)}
+			if resp != nil {
+				result.StatusCode = resp.StatusCode
+				result.CorrelationID = resp.Header.Get("X-Correlation-Id")
+			}
+			end(result)
+		}()
+	}
+	if dryRun {
+		return c.send(ctx, method, uri, body, result, true)
+	}
+	resp, err = c.limitedSend(ctx, method, uri, body, result)
+	if c.correctClockSkew(resp, err) && isIdempotent(method) {
+		resp, err = c.limitedSend(ctx, method, uri, body, result)
+	}
+	return resp, err
+}
+
+// limitedSend sends a request within the budget of its class when a
+// RateLimiter is set.
+func (c *Client) limitedSend(ctx context.Context, method string, uri url.URL, body []byte, result any) (resp *http.Response, err error) {
+	if c.RateLimiter != nil {
+		class := classifyRequest(method, uri.Path)
+		if err = c.RateLimiter.Wait(ctx, class); err != nil {
+			return nil, err
+		}
+		defer func() { c.RateLimiter.Observe(class, resp, err) }()
+	}
+	return c.send(ctx, method, uri, body, result, false)
+}
+
+func (c *Client) send(ctx context.Context, method string, uri url.URL, body []byte, result any, dryRun bool) (resp *http.Response, err error) {
 	var (
 		req          *http.Request
 		responseBody []byte
 	)
-	requestTime := time.Now().UTC().Format("2006-01-02 15:04:05")
-	if req, err = http.NewRequest(method, uri.String(), bytes.NewBuffer(body)); err != nil {
+	requestTime := c.now().UTC().Format("2006-01-02 15:04:05")
+	if req, err = http.NewRequestWithContext(ctx, method, uri.String(), bytes.NewBuffer(body)); err != nil {
 		return nil, err
 	}
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("x-azurecdn-request-date", requestTime)
-	req.Header.Set("Authorization", c.CalculateAuthorizationHeader(uri, requestTime, method))
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	authorization, err := c.CalculateAuthorizationHeader(ctx, uri, requestTime, method)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	if dryRun {
+		return c.dryRun(req, body, result)
+	}
+	op := operationOf(method, uri.Path)
+	c.logRequest(op, req, body)
+	sent := time.Now()
+	defer func() { c.logResponse(op, req, resp, responseBody, time.Since(sent), err) }()
 	if resp, err = c.HTTPClient.Do(req); err != nil {
 		return nil, err
 	}
+	c.measureClockSkew(resp, sent, time.Now())
+	defer resp.Body.Close()
 	if responseBody, err = io.ReadAll(resp.Body); err != nil {
 		return nil, err
 	}
-	responseError := &ErrorResponse{}
+	// Decoded into a value, so a null body leaves it empty.
+	var responseError ErrorResponse
 	if err = json.Unmarshal(responseBody, &responseError); err == nil &&
 		responseError.Succeeded != nil && !*responseError.Succeeded {
-		return resp, responseError
+		return resp, &responseError
 	}
 	if err = json.Unmarshal(responseBody, &result); err != nil {
 		return resp, err
@@ -96,7 +197,13 @@ func (e ErrorResponse) Error() string {
 	return fmt.Sprintf("%s: %s", e.ErrorInfo.Type, e.ErrorInfo.Message)
 }
 
-func (c *Client) CalculateAuthorizationHeader(requestURL url.URL, requestTime, httpMethod string) string {
+// CalculateAuthorizationHeader signs a request with the key pair of the
+// client, retrieved from Credentials with ctx when set.
+func (c *Client) CalculateAuthorizationHeader(ctx context.Context, requestURL url.URL, requestTime, httpMethod string) (string, error) {
+	creds, err := c.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
 	var path = requestURL.Path
 	m, _ := url.ParseQuery(requestURL.RawQuery)
 
@@ -112,8 +219,8 @@ func (c *Client) CalculateAuthorizationHeader(requestURL url.URL, requestTime, h
 
 	var queries = strings.Join(orderedQueries, ", ")
 	content := fmt.Sprintf("%s\r\n%s\r\n%s\r\n%s", path, queries, requestTime, httpMethod)
-	hash := hmac.New(sha256.New, []byte(c.KeyValue))
+	hash := hmac.New(sha256.New, []byte(creds.KeyValue))
 	hash.Write([]byte(content))
 	digest := strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
-	return fmt.Sprintf("AzureCDN %s:%s", c.KeyID, digest)
+	return fmt.Sprintf("AzureCDN %s:%s", creds.KeyID, digest), nil
 }
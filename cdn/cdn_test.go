@@ -0,0 +1,74 @@
+package cdn
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestClient returns a client sending its requests to h.
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+	client := NewClient("id", "key", "sub")
+	client.HTTPClient = srv.Client()
+	client.RestAPIEndpoint = srv.Listener.Addr().String()
+	return client
+}
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// newRecordingClient returns a client whose requests are recorded and
+// answered with response.
+func newRecordingClient(t *testing.T, response string) (*Client, *[]recordedRequest) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		requests []recordedRequest
+	)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, recordedRequest{r.Method, r.URL.Path, string(body)})
+		mu.Unlock()
+		w.Write([]byte(response))
+	}))
+	return client, &requests
+}
+
+func TestMakeRequestUrlQuery(t *testing.T) {
+	client := NewClient("id", "key", "sub")
+	u := client.MakeRequestUrl("/endpoints/ep-1/volume?apiVersion=1.0", url.Values{
+		"granularity": {"PerHour"},
+		"startTime":   {"2023-01-01T00:00:00Z"},
+	})
+	if want := "https://restapi.cdn.azure.cn/subscriptions/sub/endpoints/ep-1/volume?apiVersion=1.0&granularity=PerHour&startTime=2023-01-01T00%3A00%3A00Z"; u.String() != want {
+		t.Errorf("url = %s, want %s", u.String(), want)
+	}
+
+	got, err := client.CalculateAuthorizationHeader(context.Background(), u, "2023-01-01 00:00:00", "GET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "/subscriptions/sub/endpoints/ep-1/volume\r\n" +
+		"apiVersion:1.0, granularity:PerHour, startTime:2023-01-01T00:00:00Z\r\n" +
+		"2023-01-01 00:00:00\r\nGET"
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte(content))
+	if want := "AzureCDN id:" + strings.ToUpper(hex.EncodeToString(mac.Sum(nil))); got != want {
+		t.Errorf("authorization = %s, want %s", got, want)
+	}
+}
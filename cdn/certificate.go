@@ -1,32 +1,46 @@
 package cdn
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 )
 
 // Upload HTTPS certificate
 //
 // https://docs.azure.cn/en-us/cdn/cdn-upload-https-certificate
-func (c *Client) UploadHttpsCertificate(name, publicCertificate, privateKey string) (resp *http.Response, result *UploadHttpsCertificateResponse, err error) {
+func (c *Client) UploadHttpsCertificate(ctx context.Context, name, publicCertificate, privateKey string) (resp *http.Response, result *UploadHttpsCertificateResponse, err error) {
 	postBody, _ := json.Marshal(&UploadHttpsCertificatePostBody{
 		CertificateName:   name,
 		PublicCertificate: publicCertificate,
 		PrivateKey:        privateKey,
 		Format:            "Pem",
 	})
-	// fmt.Println(string(postBody))
-	resp, err = c.Request("POST", c.MakeRequestUrl("/https/certificates?apiVersion=1.0", nil), postBody, &result)
+	resp, err = c.Request(ctx, "POST", c.MakeRequestUrl("/https/certificates?apiVersion=1.0", nil), postBody, &result)
 	return resp, result, err
 }
 
 type UploadHttpsCertificatePostBody struct {
 	CertificateName   string
 	PublicCertificate string
-	PrivateKey        string
+	PrivateKey        string // Sent as is, redacted when formatted with fmt
 	Format            string
 }
 
+// String prints the fields with PrivateKey redacted, also for %v and %+v,
+// so logging the body never reveals the key.
+func (b UploadHttpsCertificatePostBody) String() string {
+	return fmt.Sprintf("{CertificateName:%s PublicCertificate:%s PrivateKey:%s Format:%s}",
+		b.CertificateName, b.PublicCertificate, Secret(b.PrivateKey), b.Format)
+}
+
+// GoString is String for %#v.
+func (b UploadHttpsCertificatePostBody) GoString() string {
+	return fmt.Sprintf("cdn.UploadHttpsCertificatePostBody{CertificateName:%q, PublicCertificate:%q, PrivateKey:%q, Format:%q}",
+		b.CertificateName, b.PublicCertificate, Secret(b.PrivateKey).String(), b.Format)
+}
+
 type UploadHttpsCertificateResponse struct {
 	CertificateID           string
 	CertificateName         string
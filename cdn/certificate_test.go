@@ -0,0 +1,47 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The private key is sent as is, only logs and dumps redact it.
+func TestUploadHttpsCertificateBody(t *testing.T) {
+	client, requests := newRecordingClient(t, `{"CertificateID":"cert-1"}`)
+	if _, _, err := client.UploadHttpsCertificate(context.Background(), "cert", "PUBLIC", "PRIVATE"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("requests = %+v", *requests)
+	}
+	var body UploadHttpsCertificatePostBody
+	if err := json.Unmarshal([]byte((*requests)[0].Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := UploadHttpsCertificatePostBody{CertificateName: "cert", PublicCertificate: "PUBLIC", PrivateKey: "PRIVATE", Format: "Pem"}
+	if body != want {
+		t.Errorf("body = %+v, want %+v", body, want)
+	}
+}
+
+func TestUploadHttpsCertificatePostBodyFormat(t *testing.T) {
+	body := UploadHttpsCertificatePostBody{CertificateName: "cert", PublicCertificate: "PUBLIC", PrivateKey: "PRIVATE", Format: "Pem"}
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{"%v", "{CertificateName:cert PublicCertificate:PUBLIC PrivateKey:REDACTED Format:Pem}"},
+		{"%+v", "{CertificateName:cert PublicCertificate:PUBLIC PrivateKey:REDACTED Format:Pem}"},
+		{"%#v", `cdn.UploadHttpsCertificatePostBody{CertificateName:"cert", PublicCertificate:"PUBLIC", PrivateKey:"REDACTED", Format:"Pem"}`},
+	} {
+		if got := fmt.Sprintf(tt.format, body); got != tt.want {
+			t.Errorf("Sprintf(%q) = %s, want %s", tt.format, got, tt.want)
+		}
+		if got := fmt.Sprintf(tt.format, &body); strings.Contains(got, "PRIVATE") {
+			t.Errorf("Sprintf(%q) of a pointer = %s", tt.format, got)
+		}
+	}
+}
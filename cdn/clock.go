@@ -0,0 +1,125 @@
+package cdn
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ClockSkewTolerance is the measured skew below which the clocks are
+// considered in sync: the Date header has a resolution of one second, so
+// smaller skews are noise.
+const ClockSkewTolerance = 2 * time.Second
+
+// DefaultClockSkewThreshold is the difference between the measured skew and
+// the applied offset from which a rejected request is blamed on the request
+// date, unless Client.ClockSkewThreshold is set. The API documentation states
+// no allowed skew, so this is a client-side default.
+const DefaultClockSkewThreshold = time.Minute
+
+// clock tracks the difference between the local clock and the server clock.
+type clock struct {
+	skew     atomic.Int64 // Last measured server time minus local time, in nanoseconds
+	measured atomic.Bool
+	offset   atomic.Int64 // Added to the local time when signing, in nanoseconds
+}
+
+// ClockSkew returns the last measured difference between the server clock
+// and the local clock, positive when the local clock is behind. ok is false
+// until a response with a Date header has been received.
+func (c *Client) ClockSkew() (skew time.Duration, ok bool) {
+	return time.Duration(c.clock.skew.Load()), c.clock.measured.Load()
+}
+
+// ClockOffset returns the correction added to the local clock when signing
+// requests.
+func (c *Client) ClockOffset() time.Duration {
+	return time.Duration(c.clock.offset.Load())
+}
+
+// SetClockOffset sets the correction added to the local clock when signing
+// requests. The client sets it on its own when the API rejects a request
+// and the measured skew explains it.
+func (c *Client) SetClockOffset(offset time.Duration) {
+	c.clock.offset.Store(int64(offset))
+}
+
+// now is the local time corrected by the clock offset.
+func (c *Client) now() time.Time {
+	return time.Now().Add(c.ClockOffset())
+}
+
+// measureClockSkew estimates the server time from the Date header of resp,
+// assuming it was taken halfway between sending and receiving. The header
+// is truncated to the second, so half a second is added.
+func (c *Client) measureClockSkew(resp *http.Response, sent, received time.Time) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := date.Add(500 * time.Millisecond).Sub(local)
+	c.clock.skew.Store(int64(skew))
+	c.clock.measured.Store(true)
+}
+
+func (c *Client) clockSkewThreshold() time.Duration {
+	if c.ClockSkewThreshold > 0 {
+		return c.ClockSkewThreshold
+	}
+	return DefaultClockSkewThreshold
+}
+
+// correctClockSkew is called when a request was rejected. If the API refused
+// the signature and the measured skew differs from the applied offset by
+// more than the threshold, the offset is updated and true is returned so the
+// request may be signed and sent again.
+func (c *Client) correctClockSkew(resp *http.Response, err error) bool {
+	if !isAuthRejection(resp, err) {
+		return false
+	}
+	skew, ok := c.ClockSkew()
+	if !ok {
+		return false
+	}
+	if diff := skew - c.ClockOffset(); diff <= c.clockSkewThreshold() && diff >= -c.clockSkewThreshold() {
+		return false
+	}
+	c.SetClockOffset(skew)
+	return true
+}
+
+// isAuthRejection reports whether the API refused the signature of a
+// request, which happens when the request date is too far from the server
+// time. Other causes, such as a wrong key, look the same, so the measured
+// skew decides whether the date is to blame.
+func isAuthRejection(resp *http.Response, err error) bool {
+	if resp == nil {
+		return false
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return true
+	}
+	var e *ErrorResponse
+	if errors.As(err, &e) && e.ErrorInfo != nil {
+		text := strings.ToLower(e.ErrorInfo.Type + " " + e.ErrorInfo.Message)
+		for _, word := range []string{"signature", "expired", "request date", "timestamp"} {
+			if strings.Contains(text, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isIdempotent reports whether sending a request twice has the effect of
+// sending it once, so it may be retried.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package cdn
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// skewedServer rejects requests dated more than a minute away from its clock,
+// which is skew ahead of the local one, and counts the requests.
+func skewedServer(t *testing.T, skew time.Duration, status int) (*Client, func() int) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		serverNow := time.Now().Add(skew)
+		w.Header().Set("Date", serverNow.UTC().Format(http.TimeFormat))
+		date, err := time.Parse("2006-01-02 15:04:05", r.Header.Get("x-azurecdn-request-date"))
+		if err != nil || date.Sub(serverNow) > time.Minute || serverNow.Sub(date) > time.Minute {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"Succeeded": false, "ErrorInfo": {"Type": "Unauthorized", "Message": "invalid signature"}}`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	client.ClockSkewThreshold = 30 * time.Second
+	return client, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestClockSkewRetriesIdempotentRequests(t *testing.T) {
+	client, requests := skewedServer(t, time.Hour, http.StatusUnauthorized)
+	client.RateLimiter = NewRateLimiter(RateLimit{Rate: 0.001, Burst: 2}, RateLimit{}, RateLimit{})
+	if _, _, err := client.ListEndpoints(context.Background()); err != nil {
+		t.Fatalf("ListEndpoints() = %v, want success after correcting the clock", err)
+	}
+	if n := requests(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+	if offset := client.ClockOffset(); offset < 59*time.Minute || offset > 61*time.Minute {
+		t.Errorf("ClockOffset() = %s, want about 1h", offset)
+	}
+	if tokens := client.RateLimiter.buckets[OperationRead].tokens; tokens > 0.1 {
+		t.Errorf("tokens = %v, the retry did not go through the rate limiter", tokens)
+	}
+}
+
+func TestClockSkewDoesNotRetryPost(t *testing.T) {
+	client, requests := skewedServer(t, time.Hour, http.StatusUnauthorized)
+	if _, _, err := client.AddPurge(context.Background(), &AddPurgeRequest{EndpointID: "ep1"}); err == nil {
+		t.Fatal("AddPurge() succeeded with a skewed clock")
+	}
+	if n := requests(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+	if offset := client.ClockOffset(); offset < 59*time.Minute {
+		t.Errorf("ClockOffset() = %s, want the corrected offset for later requests", offset)
+	}
+	if _, _, err := client.ListEndpoints(context.Background()); err != nil {
+		t.Errorf("ListEndpoints() after the correction = %v", err)
+	}
+}
+
+func TestClockSkewBelowThresholdIsNotRetried(t *testing.T) {
+	// A wrong key is rejected whatever the date; a small skew does not
+	// explain it.
+	requests := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Date", time.Now().Add(10*time.Second).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"Succeeded": false, "ErrorInfo": {"Type": "Forbidden", "Message": "invalid signature"}}`))
+	}))
+	client.KeyValue = "wrong"
+	if _, _, err := client.ListEndpoints(context.Background()); err == nil {
+		t.Fatal("ListEndpoints() succeeded")
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+	if offset := client.ClockOffset(); offset != 0 {
+		t.Errorf("ClockOffset() = %s, want 0", offset)
+	}
+	if skew, ok := client.ClockSkew(); !ok || skew < 9*time.Second {
+		t.Errorf("ClockSkew() = %s, %v, want about 10s", skew, ok)
+	}
+}
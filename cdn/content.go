@@ -1,6 +1,7 @@
 package cdn
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,10 +10,10 @@ import (
 // Cache refreshing
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-add-purge
-func (c *Client) AddPurge(request *AddPurgeRequest) (resp *http.Response, result *AddPurgeResponse, err error) {
+func (c *Client) AddPurge(ctx context.Context, request *AddPurgeRequest) (resp *http.Response, result *AddPurgeResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/purges?apiVersion=1.0", request.EndpointID), nil)
 	postBody, _ := json.Marshal(request.Body)
-	resp, err = c.Request(http.MethodPost, reqUrl, postBody, &result)
+	resp, err = c.Request(ctx, http.MethodPost, reqUrl, postBody, &result)
 	return
 }
 
@@ -33,9 +34,9 @@ type AddPurgeResponse TaskResponse
 // Query prefetch progress
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-query-preload
-func (c *Client) QueryPreload(request *QueryPreloadRequest) (resp *http.Response, result *QueryPreloadResponse, err error) {
+func (c *Client) QueryPreload(ctx context.Context, request *QueryPreloadRequest) (resp *http.Response, result *QueryPreloadResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/preloads/%s?apiVersion=1.0", request.EndpointID, request.PreloadID), nil)
-	resp, err = c.Request(http.MethodGet, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodGet, reqUrl, nil, &result)
 	return
 }
 
@@ -64,10 +65,10 @@ type QueryPreloadResponse struct {
 // Preloading
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-add-preload
-func (c *Client) AddPreload(request *AddPreloadRequest) (resp *http.Response, result *AddPreloadResponse, err error) {
+func (c *Client) AddPreload(ctx context.Context, request *AddPreloadRequest) (resp *http.Response, result *AddPreloadResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/preloads?apiVersion=1.0", request.EndpointID), nil)
 	postBody, _ := json.Marshal(request.Body)
-	resp, err = c.Request(http.MethodPost, reqUrl, postBody, &result)
+	resp, err = c.Request(ctx, http.MethodPost, reqUrl, postBody, &result)
 	return
 }
 
@@ -86,9 +87,9 @@ type AddPreloadResponse TaskResponse
 // Check cache refresh progress
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-query-purge
-func (c *Client) QueryPurge(request *QueryPurgeRequest) (resp *http.Response, result *QueryPurgeResponse, err error) {
+func (c *Client) QueryPurge(ctx context.Context, request *QueryPurgeRequest) (resp *http.Response, result *QueryPurgeResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/purges/%s?apiVersion=1.0", request.EndpointID, request.PurgeID), nil)
-	resp, err = c.Request(http.MethodGet, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodGet, reqUrl, nil, &result)
 	return
 }
 
@@ -0,0 +1,353 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials are the key pair signing requests.
+type Credentials struct {
+	KeyID    string
+	KeyValue Secret
+}
+
+// CredentialProvider supplies the key pair for each request, so keys can be
+// rotated while the client is in use. ctx is the context of the request
+// being signed. Implementations must be safe for concurrent use.
+type CredentialProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+var ErrMissingCredentials = errors.New("missing CDN key ID or key value")
+
+func (c Credentials) validate() error {
+	if c.KeyID == "" || c.KeyValue == "" {
+		return ErrMissingCredentials
+	}
+	return nil
+}
+
+// credentials returns the key pair of Client.Credentials, or of KeyID and
+// KeyValue when no provider is set.
+func (c *Client) credentials(ctx context.Context) (Credentials, error) {
+	if c.Credentials == nil {
+		return Credentials{KeyID: c.KeyID, KeyValue: c.KeyValue}, nil
+	}
+	creds, err := c.Credentials.Retrieve(ctx)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("retrieve credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// StaticCredentials is a fixed key pair.
+type StaticCredentials Credentials
+
+func (s StaticCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	creds := Credentials(s)
+	return creds, creds.validate()
+}
+
+// EnvCredentials reads the key pair from environment variables on every
+// request, AZURE_CN_CDN_KEY_ID and AZURE_CN_CDN_KEY_VALUE unless set.
+type EnvCredentials struct {
+	KeyIDVar    string
+	KeyValueVar string
+}
+
+func (e EnvCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	keyIDVar, keyValueVar := e.KeyIDVar, e.KeyValueVar
+	if keyIDVar == "" {
+		keyIDVar = "AZURE_CN_CDN_KEY_ID"
+	}
+	if keyValueVar == "" {
+		keyValueVar = "AZURE_CN_CDN_KEY_VALUE"
+	}
+	creds := Credentials{KeyID: os.Getenv(keyIDVar), KeyValue: Secret(os.Getenv(keyValueVar))}
+	if err := creds.validate(); err != nil {
+		return creds, fmt.Errorf("%w: set %s and %s", err, keyIDVar, keyValueVar)
+	}
+	return creds, nil
+}
+
+// FileCredentials reads the key pair from a JSON file with KeyID and
+// KeyValue fields. The file is read for every request and parsed again when
+// its content changes, so rotating a key is rewriting the file, even within
+// the resolution of modification times. If the file cannot be read or parsed
+// once a key pair was loaded, the previous key pair is kept and the error is
+// passed to OnRefreshError.
+type FileCredentials struct {
+	Path string
+
+	// OnRefreshError, when set, is called with every error hidden by
+	// keeping the previous key pair, e.g. to log it.
+	OnRefreshError func(error)
+
+	mu     sync.Mutex
+	hash   [sha256.Size]byte // Of the content creds were parsed from
+	creds  Credentials
+	loaded bool
+}
+
+// NewFileCredentials returns a provider reading path, checking that it holds
+// a valid key pair now.
+func NewFileCredentials(path string) (*FileCredentials, error) {
+	f := &FileCredentials{Path: path}
+	if _, err := f.Retrieve(context.Background()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return f.fallback(err)
+	}
+	hash := sha256.Sum256(data)
+	if f.loaded && hash == f.hash {
+		return f.creds, nil
+	}
+	var creds Credentials
+	if err = json.Unmarshal(data, &creds); err != nil {
+		return f.fallback(fmt.Errorf("parse %s: %w", f.Path, err))
+	}
+	if err = creds.validate(); err != nil {
+		return f.fallback(fmt.Errorf("%s: %w", f.Path, err))
+	}
+	f.creds, f.loaded, f.hash = creds, true, hash
+	return creds, nil
+}
+
+func (f *FileCredentials) fallback(err error) (Credentials, error) {
+	if !f.loaded {
+		return Credentials{}, err
+	}
+	if f.OnRefreshError != nil {
+		f.OnRefreshError(err)
+	}
+	return f.creds, nil
+}
+
+// ProcessCredentials runs an external command printing the key pair as JSON
+// on stdout, in the style of credential_process:
+//
+//	{"KeyID": "...", "KeyValue": "...", "Expiration": "2023-01-01T00:00:00Z"}
+//
+// The output is reused until ExpiryWindow before Expiration; without
+// Expiration it is reused for TTL. When the command fails after an output
+// without Expiration, that output is kept and the error is passed to
+// OnRefreshError; an expired key pair is never used.
+type ProcessCredentials struct {
+	Command      []string
+	Timeout      time.Duration // 1 minute when zero
+	ExpiryWindow time.Duration // Refresh this long before Expiration
+	TTL          time.Duration // Lifetime of outputs without Expiration, DefaultProcessCredentialsTTL when zero
+
+	// OnRefreshError, when set, is called with every error hidden by
+	// keeping the previous key pair, e.g. to log it.
+	OnRefreshError func(error)
+
+	mu         sync.Mutex
+	creds      Credentials
+	expiration time.Time
+	expires    bool // Expiration was given by the command
+	loaded     bool
+}
+
+// DefaultProcessCredentialsTTL is how long ProcessCredentials reuses an
+// output without Expiration unless TTL is set.
+const DefaultProcessCredentialsTTL = 15 * time.Minute
+
+type processCredentialsOutput struct {
+	KeyID      string
+	KeyValue   Secret
+	Expiration *time.Time
+}
+
+// Retrieve runs the command when the previous output is expired; the command
+// is killed when ctx is done before it finishes.
+func (p *ProcessCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.loaded && time.Now().Add(p.ExpiryWindow).Before(p.expiration) {
+		return p.creds, nil
+	}
+	creds, expiration, err := p.run(ctx)
+	if err != nil {
+		if p.loaded && !p.expires {
+			if p.OnRefreshError != nil {
+				p.OnRefreshError(err)
+			}
+			return p.creds, nil
+		}
+		return Credentials{}, err
+	}
+	p.creds, p.loaded = creds, true
+	p.expires = expiration != nil
+	if p.expires {
+		p.expiration = *expiration
+	} else {
+		ttl := p.TTL
+		if ttl <= 0 {
+			ttl = DefaultProcessCredentialsTTL
+		}
+		p.expiration = time.Now().Add(ttl)
+	}
+	return creds, nil
+}
+
+// run runs the command and returns the key pair it prints.
+func (p *ProcessCredentials) run(ctx context.Context) (Credentials, *time.Time, error) {
+	if len(p.Command) == 0 {
+		return Credentials{}, nil, errors.New("credential process: empty command")
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Credentials{}, nil, fmt.Errorf("credential process %s: %w: %s", p.Command[0], err, msg)
+		}
+		return Credentials{}, nil, fmt.Errorf("credential process %s: %w", p.Command[0], err)
+	}
+	var output processCredentialsOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return Credentials{}, nil, fmt.Errorf("credential process %s: parse output: %w", p.Command[0], err)
+	}
+	creds := Credentials{KeyID: output.KeyID, KeyValue: output.KeyValue}
+	if err := creds.validate(); err != nil {
+		return Credentials{}, nil, fmt.Errorf("credential process %s: %w", p.Command[0], err)
+	}
+	return creds, output.Expiration, nil
+}
+
+// Keyring stores secrets by service and account, the interface of OS
+// keyring libraries, so they can back KeyringCredentials.
+type Keyring interface {
+	Get(service, account string) (string, error)
+}
+
+var ErrKeyNotFound = errors.New("secret not found in keyring")
+
+// KeyringCredentials reads the key value of KeyID from a Keyring on every
+// request, with KeyID as the account.
+type KeyringCredentials struct {
+	Keyring Keyring
+	Service string // "azure-cn-cdn" when empty
+	KeyID   string
+}
+
+func (k KeyringCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	service := k.Service
+	if service == "" {
+		service = "azure-cn-cdn"
+	}
+	keyValue, err := k.Keyring.Get(service, k.KeyID)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("keyring %s/%s: %w", service, k.KeyID, err)
+	}
+	creds := Credentials{KeyID: k.KeyID, KeyValue: Secret(keyValue)}
+	return creds, creds.validate()
+}
+
+// FileKeyring is a Keyring keeping each secret in its own file,
+// Dir/service/account, readable by the owner only. It stands in for an OS
+// keyring on servers without one.
+type FileKeyring struct {
+	Dir string
+}
+
+// NewFileKeyring returns a keyring in dir, by default in the user config
+// directory.
+func NewFileKeyring(dir string) (*FileKeyring, error) {
+	if dir == "" {
+		userConfig, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userConfig, "azure-cn", "keyring")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileKeyring{Dir: dir}, nil
+}
+
+func (f *FileKeyring) path(service, account string) (string, error) {
+	for _, name := range []string{service, account} {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return "", fmt.Errorf("invalid keyring name %q", name)
+		}
+	}
+	return filepath.Join(f.Dir, service, account), nil
+}
+
+func (f *FileKeyring) Get(service, account string) (string, error) {
+	path, err := f.path(service, account)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrKeyNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Set replaces the secret atomically, so a rotation never exposes a partial
+// key to concurrent readers.
+func (f *FileKeyring) Set(service, account, secret string) error {
+	path, err := f.path(service, account)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(secret); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileKeyring) Delete(service, account string) error {
+	path, err := f.path(service, account)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return ErrKeyNotFound
+	}
+	return err
+}
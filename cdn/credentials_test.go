@@ -0,0 +1,154 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCredentialsRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"KeyID":"id-1","KeyValue":"value-1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refreshErrors []error
+	f.OnRefreshError = func(err error) { refreshErrors = append(refreshErrors, err) }
+
+	if err = os.WriteFile(path, []byte(`{"KeyID":"id-2","KeyValue":"value-2"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := f.Retrieve(context.Background())
+	if err != nil || creds.KeyID != "id-2" || creds.KeyValue != "value-2" {
+		t.Fatalf("after rotation Retrieve() = %+v, %v", creds, err)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"KeyID":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err = f.Retrieve(context.Background()); err != nil || creds.KeyID != "id-2" {
+		t.Errorf("with a corrupt file Retrieve() = %+v, %v, want the previous keys", creds, err)
+	}
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err = f.Retrieve(context.Background()); err != nil || creds.KeyID != "id-2" {
+		t.Errorf("with a removed file Retrieve() = %+v, %v, want the previous keys", creds, err)
+	}
+	if len(refreshErrors) != 2 || !errors.Is(refreshErrors[1], os.ErrNotExist) {
+		t.Errorf("refresh errors = %v, want a parse error and a missing file", refreshErrors)
+	}
+}
+
+// A rotation keeping the size and modification time is still noticed.
+func TestFileCredentialsSameSizeAndModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"KeyID":"id-1","KeyValue":"value-1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFileCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, []byte(`{"KeyID":"id-2","KeyValue":"value-2"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := f.Retrieve(context.Background()); err != nil || creds.KeyID != "id-2" {
+		t.Errorf("Retrieve() = %+v, %v, want the new keys", creds, err)
+	}
+}
+
+func TestProcessCredentialsCanceled(t *testing.T) {
+	command, keys := credentialScript(t)
+	if err := os.WriteFile(keys, []byte(`{"KeyID":"id-1","KeyValue":"value-1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := &ProcessCredentials{Command: command}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Retrieve(ctx); err == nil {
+		t.Error("Retrieve() with a canceled context succeeded")
+	}
+}
+
+func TestFileCredentialsMissing(t *testing.T) {
+	if _, err := NewFileCredentials(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("NewFileCredentials() error = %v, want not exist", err)
+	}
+}
+
+// credentialScript writes a script printing the key pair in the file at
+// keys, or failing when it is missing.
+func credentialScript(t *testing.T) (command []string, keys string) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	keys = filepath.Join(t.TempDir(), "keys.json")
+	return []string{"sh", "-c", `cat "$0"`, keys}, keys
+}
+
+func TestProcessCredentialsTTL(t *testing.T) {
+	command, keys := credentialScript(t)
+	if err := os.WriteFile(keys, []byte(`{"KeyID":"id-1","KeyValue":"value-1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var refreshErrors []error
+	p := &ProcessCredentials{Command: command, TTL: time.Nanosecond, OnRefreshError: func(err error) { refreshErrors = append(refreshErrors, err) }}
+	if creds, err := p.Retrieve(context.Background()); err != nil || creds.KeyID != "id-1" {
+		t.Fatalf("Retrieve() = %+v, %v", creds, err)
+	}
+
+	if err := os.WriteFile(keys, []byte(`{"KeyID":"id-2","KeyValue":"value-2"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := p.Retrieve(context.Background()); err != nil || creds.KeyID != "id-2" {
+		t.Fatalf("after the TTL Retrieve() = %+v, %v, want the new keys", creds, err)
+	}
+
+	if err := os.Remove(keys); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := p.Retrieve(context.Background()); err != nil || creds.KeyID != "id-2" {
+		t.Errorf("with a failing command Retrieve() = %+v, %v, want the previous keys", creds, err)
+	}
+	if len(refreshErrors) != 1 {
+		t.Errorf("refresh errors = %v, want one", refreshErrors)
+	}
+}
+
+func TestProcessCredentialsExpired(t *testing.T) {
+	command, keys := credentialScript(t)
+	expiration := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	if err := os.WriteFile(keys, []byte(`{"KeyID":"id-1","KeyValue":"value-1","Expiration":"`+expiration+`"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := &ProcessCredentials{Command: command}
+	if creds, err := p.Retrieve(context.Background()); err != nil || creds.KeyID != "id-1" {
+		t.Fatalf("Retrieve() = %+v, %v", creds, err)
+	}
+	if err := os.Remove(keys); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := p.Retrieve(context.Background()); err != nil || creds.KeyID != "id-1" {
+		t.Errorf("before Expiration Retrieve() = %+v, %v, want the cached keys", creds, err)
+	}
+	p.ExpiryWindow = 2 * time.Minute
+	if _, err := p.Retrieve(context.Background()); err == nil {
+		t.Error("Retrieve() of expiring keys with a failing command succeeded")
+	}
+}
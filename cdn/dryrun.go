@@ -0,0 +1,69 @@
+package cdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DryRunCorrelationID is the X-Correlation-Id of the responses made up in
+// dry-run mode.
+const DryRunCorrelationID = "dry-run"
+
+// dryRun prints req with secrets redacted and returns a synthetic successful
+// response.
+func (c *Client) dryRun(req *http.Request, body []byte, result any) (*http.Response, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL)
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "Authorization" {
+			value = redactAuthorization(value)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, value)
+	}
+	if len(body) > 0 {
+		body = RedactJSON(body)
+		var indented bytes.Buffer
+		if json.Indent(&indented, body, "", "  ") == nil {
+			body = indented.Bytes()
+		}
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(c.DryRun, b.String()); err != nil {
+		return nil, err
+	}
+
+	// Results that are not a TaskResponse keep their zero value.
+	_ = json.Unmarshal([]byte(`{"Succeeded":true,"IsAsync":false}`), result)
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"X-Correlation-Id": []string{DryRunCorrelationID}},
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// redactAuthorization keeps the key ID of an Authorization header and hides
+// the signature, which would be valid for a replay until the request date
+// expires.
+func redactAuthorization(value string) string {
+	if i := strings.LastIndexByte(value, ':'); i >= 0 {
+		return value[:i+1] + "REDACTED"
+	}
+	return "REDACTED"
+}
@@ -1,6 +1,7 @@
 package cdn
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,10 +10,10 @@ import (
 // Create nodes
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-create-endpoint
-func (c *Client) CreateEndpoint(body CreateEndpointRequestBody) (resp *http.Response, result *CreateEndpointResponse, err error) {
+func (c *Client) CreateEndpoint(ctx context.Context, body CreateEndpointRequestBody) (resp *http.Response, result *CreateEndpointResponse, err error) {
 	reqUrl := c.MakeRequestUrl("/endpoints?apiVersion=1.0", nil)
 	postBody, _ := json.Marshal(body)
-	resp, err = c.Request(http.MethodPost, reqUrl, postBody, &result)
+	resp, err = c.Request(ctx, http.MethodPost, reqUrl, postBody, &result)
 	return resp, result, err
 }
 
@@ -63,9 +64,9 @@ type CreateEndpointResponse Endpoint
 // Delete nodes
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-delete-endpoint
-func (c *Client) DeleteEndpoint(request *DeleteEndpointRequest) (resp *http.Response, result *DeleteEndpointResponse, err error) {
+func (c *Client) DeleteEndpoint(ctx context.Context, request *DeleteEndpointRequest) (resp *http.Response, result *DeleteEndpointResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s?apiVersion=1.0", request.EndpointID), nil)
-	resp, err = c.Request(http.MethodPost, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodDelete, reqUrl, nil, &result)
 	return resp, result, err
 }
 
@@ -78,9 +79,9 @@ type DeleteEndpointResponse TaskResponse
 // Enable nodes
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-enable-endpoint
-func (c *Client) EnableEndpoint(request *DeleteEndpointRequest) (resp *http.Response, result *DeleteEndpointResponse, err error) {
+func (c *Client) EnableEndpoint(ctx context.Context, request *EnableEndpointRequest) (resp *http.Response, result *EnableEndpointResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/enable?apiVersion=1.0", request.EndpointID), nil)
-	resp, err = c.Request(http.MethodPost, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodPost, reqUrl, nil, &result)
 	return resp, result, err
 }
 
@@ -93,9 +94,9 @@ type EnableEndpointResponse TaskResponse
 // Disable nodes
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-disable-endpoint
-func (c *Client) DisableEndpoint(request *DisableEndpointRequest) (resp *http.Response, result *DisableEndpointResponse, err error) {
+func (c *Client) DisableEndpoint(ctx context.Context, request *DisableEndpointRequest) (resp *http.Response, result *DisableEndpointResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/disable?apiVersion=1.0", request.EndpointID), nil)
-	resp, err = c.Request(http.MethodPost, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodPost, reqUrl, nil, &result)
 	return
 }
 
@@ -108,10 +109,10 @@ type DisableEndpointResponse TaskResponse
 // Cache rule configuration
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-update-cache-policy
-func (c *Client) UpdateCachePolicy(request *UpdateCachePolicyRequest) (resp *http.Response, result *TaskResponse, err error) {
+func (c *Client) UpdateCachePolicy(ctx context.Context, request *UpdateCachePolicyRequest) (resp *http.Response, result *TaskResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/cacherules?apiVersion=1.0", request.EndpointID), nil)
-	body, _ := json.Marshal(request)
-	resp, err = c.Request(http.MethodPut, reqUrl, body, &result)
+	body, _ := json.Marshal(request.Body)
+	resp, err = c.Request(ctx, http.MethodPut, reqUrl, body, &result)
 	return
 }
 
@@ -149,10 +150,10 @@ type UpdateCachePolicyResponse TaskResponse
 // Deploy HTTPS
 //
 // https://docs.azure.cn/en-us/cdn/cdn-create-https-binding
-func (c *Client) CreateHttpsBinding(request *CreateHttpsBindingRequestBody) (resp *http.Response, result *CreateHttpsBindingResponse, err error) {
+func (c *Client) CreateHttpsBinding(ctx context.Context, request *CreateHttpsBindingRequestBody) (resp *http.Response, result *CreateHttpsBindingResponse, err error) {
 	reqUrl := c.MakeRequestUrl("/https/bindings?apiVersion=1.0", nil)
 	body, _ := json.Marshal(request)
-	resp, err = c.Request(http.MethodPost, reqUrl, body, &result)
+	resp, err = c.Request(ctx, http.MethodPost, reqUrl, body, &result)
 	return
 }
 
@@ -176,16 +177,16 @@ type CreateHttpsBindingResponse TaskResponse
 // Update node details
 //
 // https://docs.azure.cn/zh-cn/cdn/cdn-api-update-endpoint
-func (c *Client) UpdateEndpoint(request *UpdateEndpointRequest) (resp *http.Response, result *UpdateEndpointResponse, err error) {
-	body, _ := json.Marshal(request)
+func (c *Client) UpdateEndpoint(ctx context.Context, request *UpdateEndpointRequest) (resp *http.Response, result *UpdateEndpointResponse, err error) {
+	body, _ := json.Marshal(request.Body)
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s?apiVersion=1.0", request.EndpointID), nil)
-	resp, err = c.Request(http.MethodPut, reqUrl, body, &result)
+	resp, err = c.Request(ctx, http.MethodPut, reqUrl, body, &result)
 	return resp, result, err
 }
 
 type UpdateEndpointRequest struct {
 	EndpointID string //Target node unique identifier
-	Body       UpdateCachePolicyRequestBody
+	Body       UpdateEndpointRequestBody
 }
 
 type UpdateEndpointRequestBody struct {
@@ -207,10 +208,10 @@ type UpdateEndpointResponse TaskResponse
 // Access control configuration
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-update-access-control
-func (c *Client) PutAccessControlConfiguration(request *PutAccessControlConfigurationRequest) (resp *http.Response, result *PutAccessControlConfigurationResponse, err error) {
-	body, _ := json.Marshal(request)
+func (c *Client) PutAccessControlConfiguration(ctx context.Context, request *PutAccessControlConfigurationRequest) (resp *http.Response, result *PutAccessControlConfigurationResponse, err error) {
+	body, _ := json.Marshal(request.Body)
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/accesscontrol?apiVersion=1.0", request.EndpointID), nil)
-	resp, err = c.Request(http.MethodPut, reqUrl, body, &result)
+	resp, err = c.Request(ctx, http.MethodPut, reqUrl, body, &result)
 	return resp, result, err
 }
 
@@ -229,25 +230,43 @@ const (
 	RefererControlTypeBlockList RefererControlType = "BlockList"
 )
 
-type PutAccessControlConfigurationRequestBody struct {
+type AccessControlConfiguration struct {
 	ForbiddenIps   []string //List of forbidden IPs
-	RefererControl struct {
-		Enabled            bool
-		PathPatterns       []string //[anti-]theft link file path connection
-		Referers           []string //[anti-]theft link connection
-		RefererControlType string   //Anti-theft chain type
-	}
+	RefererControl RefererControl
 }
 
+type RefererControl struct {
+	Enabled            bool
+	PathPatterns       []string           //[anti-]theft link file path connection
+	Referers           []string           //[anti-]theft link connection
+	RefererControlType RefererControlType //Anti-theft chain type
+}
+
+type PutAccessControlConfigurationRequestBody AccessControlConfiguration
+
 type PutAccessControlConfigurationResponse TaskResponse
 
+// Get access control configuration
+//
+// https://docs.azure.cn/en-us/cdn/cdn-api-get-access-control
+func (c *Client) GetAccessControlConfiguration(ctx context.Context, request *GetAccessControlConfigurationRequest) (resp *http.Response, result *GetAccessControlConfigurationResponse, err error) {
+	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/accesscontrol?apiVersion=1.0", request.EndpointID), nil)
+	resp, err = c.Request(ctx, http.MethodGet, reqUrl, nil, &result)
+	return resp, result, err
+}
+
+type GetAccessControlConfigurationRequest struct {
+	EndpointID string //Target node unique identifier
+}
+
+type GetAccessControlConfigurationResponse AccessControlConfiguration
+
 // Get cache rule information
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-get-cache-policy
-func (c *Client) GetCachePolicy(request *GetCachePolicyRequest) (resp *http.Response, result *GetCachePolicyResponse, err error) {
+func (c *Client) GetCachePolicy(ctx context.Context, request *GetCachePolicyRequest) (resp *http.Response, result *GetCachePolicyResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/cacherules?apiVersion=1.0", request.EndpointID), nil)
-	body, _ := json.Marshal(request)
-	resp, err = c.Request(http.MethodPut, reqUrl, body, &result)
+	resp, err = c.Request(ctx, http.MethodGet, reqUrl, nil, &result)
 	return
 }
 
@@ -260,9 +279,9 @@ type GetCachePolicyResponse CachePolicy
 // Get node information
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-get-endpoint
-func (c *Client) GetEndpoint(request *GetEndpointRequest) (resp *http.Response, result *GetEndpointResponse, err error) {
+func (c *Client) GetEndpoint(ctx context.Context, request *GetEndpointRequest) (resp *http.Response, result *GetEndpointResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s?apiVersion=1.0", request.EndpointID), nil)
-	resp, err = c.Request(http.MethodGet, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodGet, reqUrl, nil, &result)
 	return
 }
 
@@ -275,8 +294,8 @@ type GetEndpointResponse Endpoint
 // Get information for all subscribed nodes
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-list-endpoints
-func (c *Client) ListEndpoints() (resp *http.Response, result *ListEndpointsResponse, err error) {
-	resp, err = c.Request(http.MethodGet, c.MakeRequestUrl("/endpoints?apiVersion=1.0", nil), nil, &result)
+func (c *Client) ListEndpoints(ctx context.Context) (resp *http.Response, result *ListEndpointsResponse, err error) {
+	resp, err = c.Request(ctx, http.MethodGet, c.MakeRequestUrl("/endpoints?apiVersion=1.0", nil), nil, &result)
 	return resp, result, err
 }
 
@@ -0,0 +1,67 @@
+package cdn
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestEndpointRequests(t *testing.T) {
+	host := "origin.example.com"
+	update := &UpdateEndpointRequest{EndpointID: "ep-1"}
+	update.Body.EndpointSettings.Host = &host
+	update.Body.UpdateFlag = "HostHeader"
+
+	for _, tt := range []struct {
+		name string
+		call func(c *Client) error
+		want recordedRequest
+	}{
+		{"EnableEndpoint", func(c *Client) error {
+			_, _, err := c.EnableEndpoint(context.Background(), &EnableEndpointRequest{EndpointID: "ep-1"})
+			return err
+		}, recordedRequest{http.MethodPost, "/subscriptions/sub/endpoints/ep-1/enable", ""}},
+		{"GetCachePolicy", func(c *Client) error {
+			_, _, err := c.GetCachePolicy(context.Background(), &GetCachePolicyRequest{EndpointID: "ep-1"})
+			return err
+		}, recordedRequest{http.MethodGet, "/subscriptions/sub/endpoints/ep-1/cacherules", ""}},
+		{"UpdateCachePolicy", func(c *Client) error {
+			_, _, err := c.UpdateCachePolicy(context.Background(), &UpdateCachePolicyRequest{
+				EndpointID: "ep-1",
+				Body: &UpdateCachePolicyRequestBody{
+					Rules: []CachePolicyRule{{Type: CachePolicyRuleTypeSuffix, Items: []string{"jpg"}, TTL: 60}},
+				},
+			})
+			return err
+		}, recordedRequest{http.MethodPut, "/subscriptions/sub/endpoints/ep-1/cacherules",
+			`{"Rules":[{"Type":"Suffix","Items":["jpg"],"TTL":60}],"IgnoreCacheControl":false,"IgnoreCookie":false,"IgnoreQueryString":false}`}},
+		{"UpdateEndpoint", func(c *Client) error {
+			_, _, err := c.UpdateEndpoint(context.Background(), update)
+			return err
+		}, recordedRequest{http.MethodPut, "/subscriptions/sub/endpoints/ep-1",
+			`{"EndpointSettings":{"Host":"origin.example.com","Origin":null},"UpdateFlag":"HostHeader"}`}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, requests := newRecordingClient(t, `{"Succeeded": true}`)
+			if err := tt.call(client); err != nil {
+				t.Fatal(err)
+			}
+			if len(*requests) != 1 || (*requests)[0] != tt.want {
+				t.Errorf("got %+v, want %+v", *requests, tt.want)
+			}
+		})
+	}
+}
+
+// DeleteEndpoint is a DELETE, see
+// https://docs.azure.cn/en-us/cdn/cdn-api-delete-endpoint
+func TestDeleteEndpointMethod(t *testing.T) {
+	client, requests := newRecordingClient(t, `{"Succeeded": true}`)
+	if _, _, err := client.DeleteEndpoint(context.Background(), &DeleteEndpointRequest{EndpointID: "ep-1"}); err != nil {
+		t.Fatal(err)
+	}
+	want := recordedRequest{http.MethodDelete, "/subscriptions/sub/endpoints/ep-1", ""}
+	if len(*requests) != 1 || (*requests)[0] != want {
+		t.Errorf("got %+v, want %+v", *requests, want)
+	}
+}
@@ -0,0 +1,225 @@
+// Package export writes bandwidth and volume series as flat records with a
+// stable schema, suitable for spreadsheets, data warehouses and columnar
+// formats:
+//
+//	timestamp, endpoint_id, domain, metric, value, granularity
+//
+// Timestamps are RFC 3339 in UTC.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// Metric names
+const (
+	MetricBandwidthMbps       = "bandwidth_mbps"
+	MetricOriginBandwidthMbps = "origin_bandwidth_mbps"
+	MetricVolumeMB            = "volume_mb"
+	MetricOriginVolumeMB      = "origin_volume_mb"
+)
+
+// Columns is the header of every export, in order.
+var Columns = []string{"timestamp", "endpoint_id", "domain", "metric", "value", "granularity"}
+
+type Record struct {
+	Timestamp   time.Time       `json:"timestamp"`
+	EndpointID  string          `json:"endpoint_id"`
+	Domain      string          `json:"domain"`
+	Metric      string          `json:"metric"`
+	Value       int64           `json:"value"`
+	Granularity cdn.Granularity `json:"granularity"`
+}
+
+// Writer receives records one at a time so long ranges never need to be held
+// in memory.
+type Writer interface {
+	Write(Record) error
+	Flush() error
+}
+
+// Output format
+type Format string
+
+const (
+	FormatCSV       Format = "csv"
+	FormatJSONLines Format = "jsonl"
+)
+
+// NewWriter returns a Writer for the given format.
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVWriter(w), nil
+	case FormatJSONLines:
+		return NewJSONLinesWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter returns a Writer producing CSV with a header row. The header
+// is written on creation, so an export without records still has it.
+func NewCSVWriter(w io.Writer) Writer {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	_ = c.w.Write(Columns) // Buffered, errors are reported by Flush
+	return c
+}
+
+func (c *csvWriter) Write(r Record) error {
+	return c.w.Write([]string{
+		r.Timestamp.UTC().Format(time.RFC3339),
+		r.EndpointID,
+		r.Domain,
+		r.Metric,
+		strconv.FormatInt(r.Value, 10),
+		string(r.Granularity),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonLinesWriter struct {
+	enc *json.Encoder
+}
+
+// NewJSONLinesWriter returns a Writer producing one JSON object per line.
+func NewJSONLinesWriter(w io.Writer) Writer {
+	return &jsonLinesWriter{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonLinesWriter) Write(r Record) error {
+	r.Timestamp = r.Timestamp.UTC()
+	return j.enc.Encode(r)
+}
+
+func (j *jsonLinesWriter) Flush() error { return nil }
+
+// BandwidthRecords flattens a bandwidth series.
+func BandwidthRecords(s *cdn.BandwidthSeries) []Record {
+	records := make([]Record, 0, 2*len(s.Items))
+	for _, item := range s.Items {
+		records = append(records,
+			Record{item.Time, s.EndpointID, s.DomainName, MetricBandwidthMbps, item.BandwidthInMbps, cdn.GranularityPerFiveMinutes},
+			Record{item.Time, s.EndpointID, s.DomainName, MetricOriginBandwidthMbps, item.OriginBandwidthInMbps, cdn.GranularityPerFiveMinutes},
+		)
+	}
+	return records
+}
+
+// VolumeRecords flattens a volume series.
+func VolumeRecords(s *cdn.VolumeSeries) []Record {
+	records := make([]Record, 0, 2*len(s.Items))
+	for _, item := range s.Items {
+		records = append(records,
+			Record{item.Time, s.EndpointID, s.DomainName, MetricVolumeMB, item.VolumeInMB, s.Granularity},
+			Record{item.Time, s.EndpointID, s.DomainName, MetricOriginVolumeMB, item.OriginVolumeInMB, s.Granularity},
+		)
+	}
+	return records
+}
+
+// Exporter fetches traffic statistics chunk by chunk and streams them to a
+// Writer.
+type Exporter struct {
+	Client      *cdn.Client
+	Writer      Writer
+	Bandwidth   bool            // Export bandwidth series
+	Volume      bool            // Export volume series
+	Granularity cdn.Granularity // Volume granularity, PerHour when empty
+	ChunkSize   time.Duration   // Range fetched before writing, one day when zero
+}
+
+// Export writes the statistics of the endpoints between start and end.
+// Records of each endpoint are written in time order, endpoint after
+// endpoint. Domains are looked up with ListEndpoints.
+func (e *Exporter) Export(ctx context.Context, endpointIDs []string, start, end time.Time) error {
+	domains := map[string]string{}
+	if _, endpoints, err := e.Client.ListEndpoints(ctx); err == nil && endpoints != nil {
+		for _, endpoint := range *endpoints {
+			domains[endpoint.EndpointID] = endpoint.Settings.CustomDomain
+		}
+	}
+	granularity := e.Granularity
+	if granularity == "" {
+		granularity = cdn.GranularityPerHour
+	}
+	chunk := e.ChunkSize
+	if chunk <= 0 {
+		chunk = 24 * time.Hour
+	}
+
+	for _, endpointID := range endpointIDs {
+		var lastBandwidth, lastVolume time.Time
+		for _, w := range cdn.SplitTimeRange(start, end, chunk, granularity.Step()) {
+			if e.Bandwidth {
+				series, err := e.Client.QueryBandwidth(ctx, &cdn.GetEndpointBandwidthRequest{
+					EndpointId: endpointID,
+					StartTime:  w.Start,
+					EndTime:    w.End,
+				})
+				if err != nil {
+					return fmt.Errorf("bandwidth of %s: %w", endpointID, err)
+				}
+				if series.DomainName == "" {
+					series.DomainName = domains[endpointID]
+				}
+				if lastBandwidth, err = e.write(BandwidthRecords(series), lastBandwidth); err != nil {
+					return err
+				}
+			}
+			if e.Volume {
+				series, err := e.Client.QueryVolume(ctx, &cdn.GetEndpointVolumeRequest{
+					EndpointID:  endpointID,
+					Granularity: granularity,
+					StartTime:   w.Start,
+					EndTime:     w.End,
+				})
+				if err != nil {
+					return fmt.Errorf("volume of %s: %w", endpointID, err)
+				}
+				if series.DomainName == "" {
+					series.DomainName = domains[endpointID]
+				}
+				if lastVolume, err = e.write(VolumeRecords(series), lastVolume); err != nil {
+					return err
+				}
+			}
+		}
+		if err := e.Writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return e.Writer.Flush()
+}
+
+// write skips records already written by the previous chunk, whose end is
+// the start of the next one, and returns the last written timestamp.
+func (e *Exporter) write(records []Record, last time.Time) (time.Time, error) {
+	for _, r := range records {
+		if !last.IsZero() && !r.Timestamp.After(last) {
+			continue
+		}
+		if err := e.Writer.Write(r); err != nil {
+			return last, err
+		}
+	}
+	if n := len(records); n > 0 && records[n-1].Timestamp.After(last) {
+		last = records[n-1].Timestamp
+	}
+	return last, nil
+}
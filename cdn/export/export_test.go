@@ -0,0 +1,37 @@
+package export
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func TestCSVWriterEmptyExportHasHeader(t *testing.T) {
+	var out strings.Builder
+	e := &Exporter{Client: cdn.NewClient("id", "key", "sub"), Writer: NewCSVWriter(&out)}
+	if err := e.Export(context.Background(), nil, time.Now().Add(-time.Hour), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(Columns, ",") + "\n"; out.String() != want {
+		t.Errorf("export = %q, want %q", out.String(), want)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var out strings.Builder
+	w := NewCSVWriter(&out)
+	ts := time.Date(2023, 1, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	if err := w.Write(Record{ts, "ep1", "cdn.example.cn", MetricVolumeMB, 42, cdn.GranularityPerHour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join(Columns, ",") + "\n2023-01-01T00:00:00Z,ep1,cdn.example.cn,volume_mb,42," + string(cdn.GranularityPerHour) + "\n"
+	if out.String() != want {
+		t.Errorf("export = %q, want %q", out.String(), want)
+	}
+}
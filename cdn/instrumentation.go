@@ -0,0 +1,213 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation identifies an API call for instrumentation.
+type Operation struct {
+	Name       string // Client method making the call, e.g. "AddPurge", or "Request" for other paths
+	EndpointID string // Empty for calls not about an endpoint
+	HTTPMethod string
+	Path       string // URL path, without the subscription prefix
+}
+
+// OperationResult is the outcome of an Operation.
+type OperationResult struct {
+	StatusCode    int // 0 when no response was received
+	CorrelationID string
+	ErrorType     string // Empty on success, see ErrorType
+	Err           error
+	Duration      time.Duration // Including rate limiting and clock skew retries
+}
+
+// Instrumentation observes every API call, e.g. to create a tracing span per
+// Operation and record latency and error metrics. StartOperation is called
+// with the context of the call before the request is sent, and end once it
+// completes. The returned context is used for the HTTP request, so a span
+// stored in it is the parent of any span created by the transport.
+// Implementations must be safe for concurrent use.
+//
+// The package has no tracing dependency: the cdn/otel module implements
+// Instrumentation with OpenTelemetry spans and metrics.
+type Instrumentation interface {
+	StartOperation(ctx context.Context, op Operation) (_ context.Context, end func(OperationResult))
+}
+
+// Attribute is a key-value pair describing an operation, with keys following
+// the OpenTelemetry semantic conventions where one exists.
+type Attribute struct {
+	Key   string
+	Value any // string or int
+}
+
+// OperationAttributes returns the span attributes of a completed operation.
+func OperationAttributes(op Operation, result OperationResult) []Attribute {
+	attrs := []Attribute{
+		{"rpc.system", "azure-cn-cdn"},
+		{"rpc.method", op.Name},
+		{"http.request.method", op.HTTPMethod},
+		{"url.path", op.Path},
+	}
+	if op.EndpointID != "" {
+		attrs = append(attrs, Attribute{"cdn.endpoint_id", op.EndpointID})
+	}
+	if result.StatusCode != 0 {
+		attrs = append(attrs, Attribute{"http.response.status_code", result.StatusCode})
+	}
+	if result.CorrelationID != "" {
+		attrs = append(attrs, Attribute{"cdn.correlation_id", result.CorrelationID})
+	}
+	if result.ErrorType != "" {
+		attrs = append(attrs, Attribute{"error.type", result.ErrorType})
+	}
+	return attrs
+}
+
+// ErrorType classifies the error of a call: the ErrorInfo.Type of API
+// errors, the HTTP status of other failed responses, or the Go type of
+// transport and decoding errors.
+func ErrorType(resp *http.Response, err error) string {
+	var apiErr *ErrorResponse
+	switch {
+	case errors.As(err, &apiErr) && apiErr.ErrorInfo != nil && apiErr.ErrorInfo.Type != "":
+		return apiErr.ErrorInfo.Type
+	case resp != nil && resp.StatusCode >= 400:
+		return fmt.Sprint(resp.StatusCode)
+	case err != nil:
+		return fmt.Sprintf("%T", err)
+	}
+	return ""
+}
+
+// operationRoutes maps "METHOD path pattern" to the Client method calling
+// it; "*" matches one path segment.
+var operationRoutes = map[string]string{
+	"GET /endpoints":                 "ListEndpoints",
+	"POST /endpoints":                "CreateEndpoint",
+	"GET /endpoints/*":               "GetEndpoint",
+	"PUT /endpoints/*":               "UpdateEndpoint",
+	"DELETE /endpoints/*":            "DeleteEndpoint",
+	"POST /endpoints/*/enable":       "EnableEndpoint",
+	"POST /endpoints/*/disable":      "DisableEndpoint",
+	"GET /endpoints/*/cacherules":    "GetCachePolicy",
+	"PUT /endpoints/*/cacherules":    "UpdateCachePolicy",
+	"GET /endpoints/*/accesscontrol": "GetAccessControlConfiguration",
+	"PUT /endpoints/*/accesscontrol": "PutAccessControlConfiguration",
+	"POST /endpoints/*/purges":       "AddPurge",
+	"GET /endpoints/*/purges/*":      "QueryPurge",
+	"POST /endpoints/*/preloads":     "AddPreload",
+	"GET /endpoints/*/preloads/*":    "QueryPreload",
+	"GET /endpoints/*/operations/*":  "GetOperation",
+	"GET /endpoints/*/bandwidth":     "GetEndpointBandwidth",
+	"GET /endpoints/*/volume":        "GetEndpointVolume",
+	"POST /https/certificates":       "UploadHttpsCertificate",
+	"POST /https/bindings":           "CreateHttpsBinding",
+}
+
+// operationOf identifies the call made by a request to path, the URL path
+// including the subscription prefix.
+func operationOf(method, path string) Operation {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) >= 2 && segments[0] == "subscriptions" {
+		segments = segments[2:]
+	}
+	op := Operation{Name: "Request", HTTPMethod: method, Path: "/" + strings.Join(segments, "/")}
+	if len(segments) >= 2 && segments[0] == "endpoints" {
+		op.EndpointID = segments[1]
+	}
+	pattern := make([]string, len(segments))
+	copy(pattern, segments)
+	if op.EndpointID != "" {
+		pattern[1] = "*"
+	}
+	if len(pattern) == 4 {
+		pattern[3] = "*"
+	}
+	if name, ok := operationRoutes[method+" /"+strings.Join(pattern, "/")]; ok {
+		op.Name = name
+	}
+	return op
+}
+
+// LatencyBuckets are the upper bounds of the latency histogram of
+// OperationMetrics.
+var LatencyBuckets = []time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// OperationStats are the metrics of one operation name.
+type OperationStats struct {
+	Operation    string
+	Count        int64
+	Errors       int64
+	ErrorTypes   map[string]int64
+	LatencySum   time.Duration
+	LatencyCount []int64 // Cumulative count per LatencyBuckets bound
+}
+
+// OperationMetrics is an Instrumentation counting calls, errors and latency
+// per operation name, for services without a metrics library.
+type OperationMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*OperationStats
+}
+
+func (m *OperationMetrics) StartOperation(ctx context.Context, op Operation) (context.Context, func(OperationResult)) {
+	return ctx, func(result OperationResult) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.stats == nil {
+			m.stats = map[string]*OperationStats{}
+		}
+		s := m.stats[op.Name]
+		if s == nil {
+			s = &OperationStats{Operation: op.Name, ErrorTypes: map[string]int64{}, LatencyCount: make([]int64, len(LatencyBuckets))}
+			m.stats[op.Name] = s
+		}
+		s.Count++
+		if result.ErrorType != "" {
+			s.Errors++
+			s.ErrorTypes[result.ErrorType]++
+		}
+		s.LatencySum += result.Duration
+		for i, bound := range LatencyBuckets {
+			if result.Duration <= bound {
+				s.LatencyCount[i]++
+			}
+		}
+	}
+}
+
+// Snapshot returns a copy of the metrics, sorted by operation name.
+func (m *OperationMetrics) Snapshot() []OperationStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make([]OperationStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		c := *s
+		c.ErrorTypes = make(map[string]int64, len(s.ErrorTypes))
+		for k, v := range s.ErrorTypes {
+			c.ErrorTypes[k] = v
+		}
+		c.LatencyCount = append([]int64(nil), s.LatencyCount...)
+		snapshot = append(snapshot, c)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Operation < snapshot[j].Operation })
+	return snapshot
+}
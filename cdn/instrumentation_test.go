@@ -0,0 +1,84 @@
+package cdn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+// spanRecorder is an in-memory Instrumentation storing a span per operation.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	parent any
+	op     Operation
+	attrs  map[string]any
+	ended  bool
+}
+
+func (r *spanRecorder) StartOperation(ctx context.Context, op Operation) (context.Context, func(OperationResult)) {
+	span := &recordedSpan{parent: ctx.Value(spanKey{}), op: op}
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), func(result OperationResult) {
+		span.attrs = map[string]any{}
+		for _, a := range OperationAttributes(op, result) {
+			span.attrs[a.Key] = a.Value
+		}
+		span.ended = true
+	}
+}
+
+func TestInstrumentationContext(t *testing.T) {
+	var transportSpan any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Correlation-Id", "c-1")
+		w.Write([]byte(`{"Succeeded": true}`))
+	}))
+	defer srv.Close()
+
+	recorder := &spanRecorder{}
+	client := NewClient("id", "key", "sub", WithEndpoint(srv.URL), WithInstrumentation(recorder),
+		WithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			transportSpan = req.Context().Value(spanKey{})
+			return http.DefaultTransport.RoundTrip(req)
+		})))
+
+	ctx := context.WithValue(context.Background(), spanKey{}, "caller")
+	if _, _, err := client.DeleteEndpoint(ctx, &DeleteEndpointRequest{EndpointID: "ep-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(recorder.spans))
+	}
+	span := recorder.spans[0]
+	if span.parent != "caller" {
+		t.Errorf("span parent = %v, want the caller's span", span.parent)
+	}
+	if transportSpan != span {
+		t.Errorf("transport saw span %v, want the operation span", transportSpan)
+	}
+	if !span.ended {
+		t.Fatal("span not ended")
+	}
+	for key, want := range map[string]any{
+		"rpc.method":                "DeleteEndpoint",
+		"http.request.method":       "DELETE",
+		"cdn.endpoint_id":           "ep-1",
+		"http.response.status_code": 200,
+		"cdn.correlation_id":        "c-1",
+	} {
+		if got := span.attrs[key]; got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package cdn
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// ParseIPPrefix parses an IPv4/IPv6 address or CIDR into a masked prefix.
+// A plain address is treated as a single-host prefix (/32 or /128).
+func ParseIPPrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		return p.Masked(), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q: %w", s, err)
+	}
+	a = a.Unmap().WithZone("")
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// ParseIPList parses every entry with ParseIPPrefix and merges the result.
+func ParseIPList(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		p, err := ParseIPPrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p)
+	}
+	return MergeIPPrefixes(prefixes), nil
+}
+
+// MergeIPPrefixes returns the smallest sorted set of prefixes covering exactly
+// the same addresses as prefixes. Duplicate, nested, overlapping and adjacent
+// ranges are combined.
+func MergeIPPrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	ranges := make([]ipRange, 0, len(prefixes))
+	for _, p := range prefixes {
+		ranges = append(ranges, prefixRange(p))
+	}
+	return rangesToPrefixes(mergeIPRanges(ranges))
+}
+
+// SubtractIPPrefixes returns the addresses in from that are not covered by
+// remove. Removing a single host from a wider block splits the block.
+func SubtractIPPrefixes(from, remove []netip.Prefix) []netip.Prefix {
+	var pieces []ipRange
+	for _, p := range MergeIPPrefixes(from) {
+		pieces = append(pieces, prefixRange(p))
+	}
+	for _, p := range remove {
+		x := prefixRange(p)
+		var next []ipRange
+		for _, r := range pieces {
+			if !r.overlaps(x) {
+				next = append(next, r)
+				continue
+			}
+			if r.from.Less(x.from) {
+				next = append(next, ipRange{r.from, x.from.Prev()})
+			}
+			if x.to.Less(r.to) {
+				next = append(next, ipRange{x.to.Next(), r.to})
+			}
+		}
+		pieces = next
+	}
+	return rangesToPrefixes(mergeIPRanges(pieces))
+}
+
+// FormatIPPrefixes renders prefixes the way ForbiddenIps expects them: single
+// hosts as a bare address and everything else in CIDR notation.
+func FormatIPPrefixes(prefixes []netip.Prefix) []string {
+	out := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.Bits() == p.Addr().BitLen() {
+			out = append(out, p.Addr().String())
+		} else {
+			out = append(out, p.String())
+		}
+	}
+	return out
+}
+
+type ipRange struct {
+	from, to netip.Addr
+}
+
+func (r ipRange) overlaps(o ipRange) bool {
+	return r.from.BitLen() == o.from.BitLen() &&
+		r.from.Compare(o.to) <= 0 && o.from.Compare(r.to) <= 0
+}
+
+func prefixRange(p netip.Prefix) ipRange {
+	p = p.Masked()
+	return ipRange{from: p.Addr(), to: lastAddr(p)}
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	a := p.Addr()
+	b := a.As16()
+	bits := p.Bits()
+	if a.Is4() {
+		bits += 96
+	}
+	for i := bits; i < 128; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	last := netip.AddrFrom16(b)
+	if a.Is4() {
+		last = last.Unmap()
+	}
+	return last
+}
+
+func mergeIPRanges(ranges []ipRange) []ipRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].from.Less(ranges[j].from) })
+	merged := []ipRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		cur := &merged[len(merged)-1]
+		next := cur.to.Next()
+		sameFamily := cur.from.BitLen() == r.from.BitLen()
+		if sameFamily && (!next.IsValid() || r.from.Compare(next) <= 0) {
+			if cur.to.Less(r.to) {
+				cur.to = r.to
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func rangesToPrefixes(ranges []ipRange) []netip.Prefix {
+	var out []netip.Prefix
+	for _, r := range ranges {
+		from := r.from
+		for {
+			p := netip.PrefixFrom(from, from.BitLen())
+			for bits := from.BitLen() - 1; bits >= 0; bits-- {
+				q := netip.PrefixFrom(from, bits).Masked()
+				if q.Addr() != from || r.to.Less(lastAddr(q)) {
+					break
+				}
+				p = q
+			}
+			out = append(out, p)
+			last := lastAddr(p)
+			if !last.Less(r.to) {
+				break
+			}
+			from = last.Next()
+		}
+	}
+	return out
+}
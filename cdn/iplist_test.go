@@ -0,0 +1,70 @@
+package cdn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustParseIPList(t *testing.T, entries ...string) []string {
+	t.Helper()
+	prefixes, err := ParseIPList(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FormatIPPrefixes(prefixes)
+}
+
+func TestMergeIPPrefixes(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		entries []string
+		want    []string
+	}{
+		{"duplicates", []string{"192.0.2.1", "192.0.2.1/32"}, []string{"192.0.2.1"}},
+		{"nested", []string{"192.0.2.0/24", "192.0.2.128/25", "192.0.2.7"}, []string{"192.0.2.0/24"}},
+		{"adjacent", []string{"192.0.2.0/25", "192.0.2.128/25"}, []string{"192.0.2.0/24"}},
+		{"adjacent hosts", []string{"192.0.2.0", "192.0.2.1", "192.0.2.2", "192.0.2.3"}, []string{"192.0.2.0/30"}},
+		{"unaligned", []string{"192.0.2.1", "192.0.2.2"}, []string{"192.0.2.1", "192.0.2.2"}},
+		{"host bits masked", []string{"192.0.2.77/24"}, []string{"192.0.2.0/24"}},
+		{"sorted", []string{"203.0.113.0/24", "198.51.100.0/24"}, []string{"198.51.100.0/24", "203.0.113.0/24"}},
+		{"IPv6", []string{"2001:db8::/33", "2001:db8:8000::/33", "2001:db8::1"}, []string{"2001:db8::/32"}},
+		{"mixed families", []string{"2001:db8::1", "192.0.2.1"}, []string{"192.0.2.1", "2001:db8::1"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustParseIPList(t, tt.entries...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubtractIPPrefixes(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		from, remove []string
+		want         []string
+	}{
+		{"exact", []string{"192.0.2.0/24"}, []string{"192.0.2.0/24"}, []string{}},
+		{"unrelated", []string{"192.0.2.0/24"}, []string{"198.51.100.1"}, []string{"192.0.2.0/24"}},
+		{"host from block", []string{"192.0.2.0/30"}, []string{"192.0.2.1"}, []string{"192.0.2.0", "192.0.2.2/31"}},
+		{"half", []string{"192.0.2.0/24"}, []string{"192.0.2.128/25"}, []string{"192.0.2.0/25"}},
+		{"wider removal", []string{"192.0.2.7", "198.51.100.1"}, []string{"192.0.2.0/24"}, []string{"198.51.100.1"}},
+		{"IPv6", []string{"2001:db8::/127"}, []string{"2001:db8::"}, []string{"2001:db8::1"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _ := ParseIPList(tt.from)
+			remove, _ := ParseIPList(tt.remove)
+			if got := FormatIPPrefixes(SubtractIPPrefixes(from, remove)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPPrefixInvalid(t *testing.T) {
+	for _, entry := range []string{"", "not-an-ip", "192.0.2.0/33", "192.0.2.256"} {
+		if _, err := ParseIPPrefix(entry); err == nil {
+			t.Errorf("ParseIPPrefix(%q) succeeded", entry)
+		}
+	}
+}
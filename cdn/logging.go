@@ -0,0 +1,64 @@
+package cdn
+
+import (
+	"net/http"
+	"time"
+)
+
+// Logger receives the debug logs of the client as a message followed by
+// alternating keys and values. *slog.Logger implements it.
+type Logger interface {
+	Debug(msg string, args ...any)
+}
+
+// MaxLoggedBodySize bounds the bodies included in debug logs.
+const MaxLoggedBodySize = 4096
+
+func (c *Client) logRequest(op Operation, req *http.Request, body []byte) {
+	if c.Logger == nil {
+		return
+	}
+	args := []any{
+		"operation", op.Name,
+		"method", req.Method,
+		"url", req.URL.String(),
+		"headers", redactHeaders(req.Header),
+	}
+	if len(body) > 0 {
+		args = append(args, "body", loggedBody(body))
+	}
+	c.Logger.Debug("cdn request", args...)
+}
+
+func (c *Client) logResponse(op Operation, req *http.Request, resp *http.Response, body []byte, duration time.Duration, err error) {
+	if c.Logger == nil {
+		return
+	}
+	args := []any{
+		"operation", op.Name,
+		"method", req.Method,
+		"url", req.URL.String(),
+	}
+	if resp != nil {
+		args = append(args,
+			"status", resp.StatusCode,
+			"correlation_id", resp.Header.Get("X-Correlation-Id"),
+		)
+	}
+	args = append(args, "duration", duration)
+	if len(body) > 0 {
+		args = append(args, "body", loggedBody(body))
+	}
+	if err != nil {
+		args = append(args, "error", err.Error())
+	}
+	c.Logger.Debug("cdn response", args...)
+}
+
+func loggedBody(body []byte) string {
+	body = RedactJSON(body)
+	if len(body) > MaxLoggedBodySize {
+		return string(body[:MaxLoggedBodySize]) + "...(truncated)"
+	}
+	return string(body)
+}
@@ -0,0 +1,108 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger records every log entry with its arguments as a map.
+type captureLogger struct {
+	mu      sync.Mutex
+	entries []capturedLog
+}
+
+type capturedLog struct {
+	msg  string
+	args map[string]any
+}
+
+func (l *captureLogger) Debug(msg string, args ...any) {
+	entry := capturedLog{msg: msg, args: map[string]any{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		entry.args[fmt.Sprint(args[i])] = args[i+1]
+	}
+	l.mu.Lock()
+	l.entries = append(l.entries, entry)
+	l.mu.Unlock()
+}
+
+func TestLoggerRedactsBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Correlation-Id", "c-1")
+		w.Write([]byte(`{"CertificateID":"cert-1","PrivateKey":"RESPONSE-SECRET"}`))
+	}))
+	defer srv.Close()
+	logger := &captureLogger{}
+	client := NewClient("id", "key", "sub", WithEndpoint(srv.URL), WithLogger(logger))
+	if _, _, err := client.UploadHttpsCertificate(context.Background(), "cert", "PUBLIC", "REQUEST-SECRET"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logger.entries) != 2 || logger.entries[0].msg != "cdn request" || logger.entries[1].msg != "cdn response" {
+		t.Fatalf("entries = %+v, want a request and a response", logger.entries)
+	}
+	request, response := logger.entries[0].args, logger.entries[1].args
+	if body := fmt.Sprint(request["body"]); !strings.Contains(body, `"PrivateKey":"REDACTED"`) || !strings.Contains(body, "PUBLIC") {
+		t.Errorf("request body = %s", body)
+	}
+	if body := fmt.Sprint(response["body"]); !strings.Contains(body, `"PrivateKey":"REDACTED"`) || !strings.Contains(body, "cert-1") {
+		t.Errorf("response body = %s", body)
+	}
+	if response["status"] != http.StatusOK || response["correlation_id"] != "c-1" {
+		t.Errorf("response = %+v", response)
+	}
+	for _, entry := range logger.entries {
+		if logged := fmt.Sprint(entry.args); strings.Contains(logged, "SECRET") {
+			t.Errorf("%s logs a secret: %s", entry.msg, logged)
+		}
+	}
+}
+
+func TestLoggerTruncatesBodies(t *testing.T) {
+	large := `{"Items":["` + strings.Repeat("x", 2*MaxLoggedBodySize) + `"]}`
+	logger := &captureLogger{}
+	client, _ := newRecordingClient(t, large)
+	client.Logger = logger
+	if _, _, err := client.ListEndpoints(context.Background()); err == nil {
+		t.Fatal("want a decoding error for items of the wrong type")
+	}
+	body := fmt.Sprint(logger.entries[1].args["body"])
+	if want := large[:MaxLoggedBodySize] + "...(truncated)"; body != want {
+		t.Errorf("body of %d bytes logged, want %d", len(body), len(want))
+	}
+
+	small := `{"Succeeded":true}`
+	if got := loggedBody([]byte(small)); got != small {
+		t.Errorf("loggedBody(%s) = %s", small, got)
+	}
+}
+
+func TestLoggerOmitsSignature(t *testing.T) {
+	var authorization string
+	logger := &captureLogger{}
+	client := NewClient("key-id", "key", "sub", WithEndpoint("http://cdn.example.invalid"), WithLogger(logger),
+		WithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			authorization = req.Header.Get("Authorization")
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+		})))
+	_, _, _ = client.DeleteEndpoint(context.Background(), &DeleteEndpointRequest{EndpointID: "ep-1"})
+
+	signature := authorization[strings.LastIndexByte(authorization, ':')+1:]
+	if signature == "" {
+		t.Fatalf("Authorization = %q", authorization)
+	}
+	headers, _ := logger.entries[0].args["headers"].(map[string]string)
+	if got := headers["Authorization"]; got != "AzureCDN key-id:REDACTED" {
+		t.Errorf("Authorization logged as %q", got)
+	}
+	for _, entry := range logger.entries {
+		if logged := fmt.Sprint(entry.args); strings.Contains(logged, signature) {
+			t.Errorf("%s logs the signature: %s", entry.msg, logged)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cdn
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -8,8 +9,8 @@ import (
 // Get operation information
 //
 // https://docs.azure.cn/en-us/cdn/cdn-api-get-operation
-func (c *Client) GetOperation(req *GetOperationRequest) (resp *http.Response, result *GetOperationResponse, err error) {
-	resp, err = c.Request(http.MethodGet, c.MakeRequestUrl(
+func (c *Client) GetOperation(ctx context.Context, req *GetOperationRequest) (resp *http.Response, result *GetOperationResponse, err error) {
+	resp, err = c.Request(ctx, http.MethodGet, c.MakeRequestUrl(
 		fmt.Sprintf("/endpoints/%s/operations/%s?apiVersion=1.0", req.EndpointID, req.OperationID), nil), nil, &result)
 	return resp, result, err
 }
@@ -0,0 +1,123 @@
+package cdn
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTimeout bounds a whole request, including reading the response,
+// unless WithTimeout or WithHTTPClient is given.
+const DefaultTimeout = 2 * time.Minute
+
+// Option configures a Client created by NewClient.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	httpClient *http.Client
+	transport  http.RoundTripper
+	timeout    time.Duration
+	proxy      func(*http.Request) (*url.URL, error)
+	tlsConfig  *tls.Config
+	userAgent  string
+	endpoint   string
+
+	instrumentation Instrumentation
+	logger          Logger
+}
+
+// WithHTTPClient uses client as is; the other transport options are ignored.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *clientOptions) { o.httpClient = client }
+}
+
+// WithTransport sends requests through transport instead of the default
+// tuned one. WithProxy and WithTLSConfig apply to a copy of it when it is an
+// *http.Transport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) { o.transport = transport }
+}
+
+// WithTimeout bounds each request, DefaultTimeout by default. Zero means no
+// timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) { o.timeout = timeout }
+}
+
+// WithProxy selects the proxy of each request, e.g. http.ProxyURL(u). The
+// default transport uses the HTTPS_PROXY and NO_PROXY environment variables.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *clientOptions) { o.proxy = proxy }
+}
+
+// WithTLSConfig sets the TLS configuration, e.g. to trust a private CA.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *clientOptions) { o.tlsConfig = config }
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) { o.userAgent = userAgent }
+}
+
+// WithEndpoint overrides the API host, restapi.cdn.azure.cn. A value with a
+// scheme such as the URL of an httptest.Server is used as the base URL.
+func WithEndpoint(endpoint string) Option {
+	return func(o *clientOptions) { o.endpoint = endpoint }
+}
+
+// WithInstrumentation observes every API call, see Instrumentation.
+func WithInstrumentation(instrumentation Instrumentation) Option {
+	return func(o *clientOptions) { o.instrumentation = instrumentation }
+}
+
+// WithLogger logs each request and response at debug level, with secrets
+// redacted.
+func WithLogger(logger Logger) Option {
+	return func(o *clientOptions) { o.logger = logger }
+}
+
+// newTransport returns a transport dedicated to the API: it shares no state
+// with http.DefaultTransport, negotiates HTTP/2 and bounds each phase of a
+// connection.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          64,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+func (o *clientOptions) buildHTTPClient() *http.Client {
+	if o.httpClient != nil {
+		return o.httpClient
+	}
+	transport := o.transport
+	if transport == nil {
+		transport = newTransport()
+	}
+	if t, ok := transport.(*http.Transport); ok && (o.proxy != nil || o.tlsConfig != nil) {
+		if o.transport != nil {
+			t = t.Clone()
+		}
+		if o.proxy != nil {
+			t.Proxy = o.proxy
+		}
+		if o.tlsConfig != nil {
+			t.TLSClientConfig = o.tlsConfig
+		}
+		transport = t
+	}
+	return &http.Client{Transport: transport, Timeout: o.timeout}
+}
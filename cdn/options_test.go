@@ -0,0 +1,248 @@
+package cdn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewClientDefaultTransport(t *testing.T) {
+	client := NewClient("id", "key", "sub")
+	if client.HTTPClient.Timeout != DefaultTimeout {
+		t.Errorf("Timeout = %v, want %v", client.HTTPClient.Timeout, DefaultTimeout)
+	}
+	transport, ok := client.HTTPClient.Transport.(*http.Transport)
+	if !ok || transport == http.DefaultTransport {
+		t.Fatalf("Transport = %T, want a dedicated *http.Transport", client.HTTPClient.Transport)
+	}
+	if !transport.ForceAttemptHTTP2 || transport.Proxy == nil || transport.MaxIdleConnsPerHost == 0 || transport.ResponseHeaderTimeout == 0 {
+		t.Errorf("transport is not tuned: %+v", transport)
+	}
+	if other := NewClient("id", "key", "sub").HTTPClient.Transport; other == transport {
+		t.Error("clients share their transport")
+	}
+}
+
+// The default transport negotiates HTTP/2, also with a custom TLS
+// configuration.
+func TestNewClientHTTP2(t *testing.T) {
+	var proto string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+		w.Write([]byte(`[]`))
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // The untrusted handshake below fails
+	srv.StartTLS()
+	defer srv.Close()
+
+	if _, _, err := NewClient("id", "key", "sub", WithEndpoint(srv.URL)).ListEndpoints(context.Background()); err == nil {
+		t.Error("untrusted certificate accepted")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	client := NewClient("id", "key", "sub", WithEndpoint(srv.URL), WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if _, _, err := client.ListEndpoints(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if proto != "HTTP/2.0" {
+		t.Errorf("request sent with %s, want HTTP/2.0", proto)
+	}
+}
+
+func TestNewClientOptions(t *testing.T) {
+	var userAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	var proxied *url.URL
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL
+		w.Write([]byte(`[]`))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	var transported bool
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		transported = true
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	base := &http.Transport{}
+	tlsConfig := &tls.Config{ServerName: "cdn.example.cn"}
+	custom := &http.Client{}
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		check func(t *testing.T, client *Client)
+	}{
+		{
+			name: "timeout",
+			opts: []Option{WithTimeout(5 * time.Second)},
+			check: func(t *testing.T, client *Client) {
+				if client.HTTPClient.Timeout != 5*time.Second {
+					t.Errorf("Timeout = %v, want 5s", client.HTTPClient.Timeout)
+				}
+			},
+		},
+		{
+			name: "no timeout",
+			opts: []Option{WithTimeout(0)},
+			check: func(t *testing.T, client *Client) {
+				if client.HTTPClient.Timeout != 0 {
+					t.Errorf("Timeout = %v, want none", client.HTTPClient.Timeout)
+				}
+			},
+		},
+		{
+			name: "transport",
+			opts: []Option{WithEndpoint(srv.URL), WithTransport(transport)},
+			check: func(t *testing.T, client *Client) {
+				if _, _, err := client.ListEndpoints(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if !transported {
+					t.Error("request not sent through the transport")
+				}
+			},
+		},
+		{
+			name: "proxy",
+			opts: []Option{WithEndpoint("http://cdn.example.invalid"), WithProxy(http.ProxyURL(proxyURL))},
+			check: func(t *testing.T, client *Client) {
+				if _, _, err := client.ListEndpoints(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if proxied == nil || proxied.Host != "cdn.example.invalid" {
+					t.Errorf("proxy received %v", proxied)
+				}
+			},
+		},
+		{
+			name: "proxy and TLS config on a copy of the transport",
+			opts: []Option{WithTransport(base), WithProxy(http.ProxyURL(proxyURL)), WithTLSConfig(tlsConfig)},
+			check: func(t *testing.T, client *Client) {
+				got := client.HTTPClient.Transport.(*http.Transport)
+				if got == base || base.Proxy != nil {
+					t.Error("transport given to WithTransport modified")
+				}
+				if got.Proxy == nil || got.TLSClientConfig != tlsConfig {
+					t.Errorf("proxy or TLS config not set: %+v", got)
+				}
+			},
+		},
+		{
+			name: "TLS config",
+			opts: []Option{WithTLSConfig(tlsConfig)},
+			check: func(t *testing.T, client *Client) {
+				if got := client.HTTPClient.Transport.(*http.Transport).TLSClientConfig; got != tlsConfig {
+					t.Errorf("TLSClientConfig = %v, want %v", got, tlsConfig)
+				}
+			},
+		},
+		{
+			name: "HTTP client used as is",
+			opts: []Option{WithHTTPClient(custom), WithTimeout(time.Second), WithTLSConfig(tlsConfig)},
+			check: func(t *testing.T, client *Client) {
+				if client.HTTPClient != custom || custom.Timeout != 0 || custom.Transport != nil {
+					t.Errorf("HTTPClient = %+v, want the given client unchanged", client.HTTPClient)
+				}
+			},
+		},
+		{
+			name: "user agent and endpoint",
+			opts: []Option{WithEndpoint(srv.URL), WithUserAgent("agent/1.0")},
+			check: func(t *testing.T, client *Client) {
+				if client.RestAPIEndpoint != srv.URL {
+					t.Errorf("RestAPIEndpoint = %s, want %s", client.RestAPIEndpoint, srv.URL)
+				}
+				if _, _, err := client.ListEndpoints(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if userAgent != "agent/1.0" {
+					t.Errorf("User-Agent = %q, want agent/1.0", userAgent)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, NewClient("id", "key", "sub", tt.opts...))
+		})
+	}
+}
+
+func TestWithTimeoutBoundsRequests(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewClient("id", "key", "sub", WithEndpoint(srv.URL), WithTimeout(50*time.Millisecond))
+	_, _, err := client.ListEndpoints(context.Background())
+	var timeout interface{ Timeout() bool }
+	if !errors.As(err, &timeout) || !timeout.Timeout() {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+}
+
+// One Client serves concurrent calls; run with -race.
+func TestClientConcurrentUse(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"EndpointID":"ep-1"}`))
+			return
+		}
+		w.Write([]byte(`{"Succeeded":true}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient("id", "key", "sub", WithEndpoint(srv.URL))
+	client.RateLimiter = NewRateLimiter(RateLimit{Rate: 1000, Burst: 100}, RateLimit{Rate: 1000, Burst: 100}, RateLimit{Rate: 1000, Burst: 100})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, _, err := client.GetEndpoint(context.Background(), &GetEndpointRequest{EndpointID: "ep-1"}); err != nil {
+					t.Error(err)
+				}
+				if _, _, err := client.DeleteEndpoint(context.Background(), &DeleteEndpointRequest{EndpointID: "ep-1"}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 160 {
+		t.Errorf("%d calls, want 160", n)
+	}
+	if _, ok := client.ClockSkew(); !ok {
+		t.Error("clock skew not measured")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
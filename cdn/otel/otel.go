@@ -0,0 +1,97 @@
+// Package otel implements cdn.Instrumentation with OpenTelemetry: every API
+// call becomes a client span and feeds a latency histogram and an error
+// counter.
+//
+//	import cdnotel "github.com/fdkevin0/azure-cn/cdn/otel"
+//
+//	instrumentation, err := cdnotel.New(otel.GetTracerProvider(), otel.GetMeterProvider())
+//	client.Instrumentation = instrumentation
+//
+// It is a separate module, so the cdn package stays free of dependencies.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// ScopeName is the instrumentation scope of the tracer and the meter.
+const ScopeName = "github.com/fdkevin0/azure-cn/cdn"
+
+// Metric names
+const (
+	DurationMetric = "azure_cn_cdn.client.duration" // Histogram of the call duration in seconds
+	ErrorsMetric   = "azure_cn_cdn.client.errors"   // Counter of failed calls
+)
+
+// Instrumentation creates a span per cdn.Operation, named after the client
+// method, with the attributes of cdn.OperationAttributes. Metrics are
+// recorded with the method, status and error type only, as endpoint IDs and
+// correlation IDs would make too many series.
+type Instrumentation struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+// New returns an Instrumentation using the tracer and meter of ScopeName.
+func New(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) (*Instrumentation, error) {
+	meter := meterProvider.Meter(ScopeName)
+	duration, err := meter.Float64Histogram(DurationMetric, metric.WithUnit("s"), metric.WithDescription("Duration of Azure CDN API calls"))
+	if err != nil {
+		return nil, err
+	}
+	errors, err := meter.Int64Counter(ErrorsMetric, metric.WithDescription("Failed Azure CDN API calls"))
+	if err != nil {
+		return nil, err
+	}
+	return &Instrumentation{tracer: tracerProvider.Tracer(ScopeName), duration: duration, errors: errors}, nil
+}
+
+func (i *Instrumentation) StartOperation(ctx context.Context, op cdn.Operation) (context.Context, func(cdn.OperationResult)) {
+	ctx, span := i.tracer.Start(ctx, op.Name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, func(result cdn.OperationResult) {
+		span.SetAttributes(Attributes(cdn.OperationAttributes(op, result))...)
+		if result.Err != nil {
+			span.RecordError(result.Err)
+			span.SetStatus(codes.Error, result.ErrorType)
+		}
+		span.End()
+
+		attrs := []attribute.KeyValue{attribute.String("rpc.method", op.Name)}
+		if result.StatusCode != 0 {
+			attrs = append(attrs, attribute.Int("http.response.status_code", result.StatusCode))
+		}
+		if result.ErrorType != "" {
+			attrs = append(attrs, attribute.String("error.type", result.ErrorType))
+		}
+		set := metric.WithAttributes(attrs...)
+		i.duration.Record(ctx, result.Duration.Seconds(), set)
+		if result.ErrorType != "" {
+			i.errors.Add(ctx, 1, set)
+		}
+	}
+}
+
+// Attributes converts cdn attributes to OpenTelemetry attributes.
+func Attributes(attrs []cdn.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
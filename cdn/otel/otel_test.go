@@ -0,0 +1,149 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func TestInstrumentation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Correlation-Id", "c-1")
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"Succeeded":false,"ErrorInfo":{"Type":"NotFound","Message":"no endpoint"}}`))
+			return
+		}
+		w.Write([]byte(`{"EndpointID":"ep-1"}`))
+	}))
+	defer srv.Close()
+
+	spans := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	reader := sdkmetric.NewManualReader()
+	instrumentation, err := New(tracerProvider, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var transportSpan trace.SpanContext
+	client := cdn.NewClient("id", "key", "sub", cdn.WithEndpoint(srv.URL), cdn.WithInstrumentation(instrumentation),
+		cdn.WithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			transportSpan = trace.SpanContextFromContext(req.Context())
+			return http.DefaultTransport.RoundTrip(req)
+		})))
+
+	ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "caller")
+	if _, _, err := client.GetEndpoint(ctx, &cdn.GetEndpointRequest{EndpointID: "ep-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.DeleteEndpoint(ctx, &cdn.DeleteEndpointRequest{EndpointID: "ep-1"}); err == nil {
+		t.Fatal("want the API error")
+	}
+	parent.End()
+
+	ended := spans.GetSpans()
+	if len(ended) != 3 {
+		t.Fatalf("got %d spans, want 3", len(ended))
+	}
+	get, del := ended[0], ended[1]
+	if get.Name != "GetEndpoint" || del.Name != "DeleteEndpoint" {
+		t.Errorf("span names = %s, %s", get.Name, del.Name)
+	}
+	if get.SpanKind != trace.SpanKindClient || get.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("span kind %v, parent %v, want a client span under the caller's", get.SpanKind, get.Parent.SpanID())
+	}
+	if transportSpan.SpanID() != del.SpanContext.SpanID() {
+		t.Error("the transport did not receive the context of the operation span")
+	}
+	for _, tt := range []struct {
+		span  sdktrace.ReadOnlySpan
+		attrs map[attribute.Key]attribute.Value
+		code  codes.Code
+	}{
+		{get.Snapshot(), map[attribute.Key]attribute.Value{
+			"rpc.method":                attribute.StringValue("GetEndpoint"),
+			"cdn.endpoint_id":           attribute.StringValue("ep-1"),
+			"http.response.status_code": attribute.IntValue(200),
+			"cdn.correlation_id":        attribute.StringValue("c-1"),
+		}, codes.Unset},
+		{del.Snapshot(), map[attribute.Key]attribute.Value{
+			"rpc.method":                attribute.StringValue("DeleteEndpoint"),
+			"http.response.status_code": attribute.IntValue(404),
+			"error.type":                attribute.StringValue("NotFound"),
+		}, codes.Error},
+	} {
+		got := map[attribute.Key]attribute.Value{}
+		for _, kv := range tt.span.Attributes() {
+			got[kv.Key] = kv.Value
+		}
+		for key, want := range tt.attrs {
+			if got[key] != want {
+				t.Errorf("%s: %s = %v, want %v", tt.span.Name(), key, got[key].Emit(), want.Emit())
+			}
+		}
+		if tt.span.Status().Code != tt.code {
+			t.Errorf("%s: status %v, want %v", tt.span.Name(), tt.span.Status().Code, tt.code)
+		}
+	}
+	if len(del.Events) != 1 || del.Events[0].Name != "exception" {
+		t.Errorf("events = %+v, want the recorded error", del.Events)
+	}
+
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	duration, ok := metrics[DurationMetric].(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 2 {
+		t.Fatalf("%s = %+v, want a data point per operation", DurationMetric, metrics[DurationMetric])
+	}
+	for _, point := range duration.DataPoints {
+		if method, _ := point.Attributes.Value("rpc.method"); point.Count != 1 || (method.AsString() != "GetEndpoint" && method.AsString() != "DeleteEndpoint") {
+			t.Errorf("duration point %v with count %d", point.Attributes.ToSlice(), point.Count)
+		}
+		if _, ok := point.Attributes.Value("cdn.endpoint_id"); ok {
+			t.Error("endpoint ID recorded as a metric attribute")
+		}
+	}
+	errors, ok := metrics[ErrorsMetric].(metricdata.Sum[int64])
+	if !ok || len(errors.DataPoints) != 1 {
+		t.Fatalf("%s = %+v, want one data point", ErrorsMetric, metrics[ErrorsMetric])
+	}
+	if point := errors.DataPoints[0]; point.Value != 1 || !point.Attributes.HasValue("error.type") {
+		t.Errorf("errors point %v = %d, want 1 with the error type", point.Attributes.ToSlice(), point.Value)
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	got := Attributes([]cdn.Attribute{{Key: "a", Value: "x"}, {Key: "b", Value: 404}, {Key: "c", Value: true}})
+	want := []attribute.KeyValue{attribute.String("a", "x"), attribute.Int("b", 404), attribute.String("c", "true")}
+	if len(got) != len(want) {
+		t.Fatalf("Attributes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Attributes[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,207 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OperationClass groups requests sharing a budget in a RateLimiter.
+type OperationClass string
+
+const (
+	OperationRead    OperationClass = "read"    // GET requests
+	OperationWrite   OperationClass = "write"   // Requests changing endpoints, certificates or access control
+	OperationContent OperationClass = "content" // Purge and preload submissions
+)
+
+// classifyRequest returns the budget a request is charged to.
+func classifyRequest(method, path string) OperationClass {
+	if method == http.MethodGet {
+		return OperationRead
+	}
+	if method == http.MethodPost && (strings.HasSuffix(path, "/purges") || strings.HasSuffix(path, "/preloads")) {
+		return OperationContent
+	}
+	return OperationWrite
+}
+
+// RateLimit is a token bucket budget: Rate requests per second on average,
+// with bursts of up to Burst requests. A zero Rate is unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int // 1 when zero
+}
+
+// RateLimiter delays requests so each OperationClass stays within its
+// budget. It is safe to share across goroutines and clients.
+//
+// When the API throttles a request, the rate of its class is halved, down to
+// a sixteenth of the configured rate, and the class is paused for the
+// Retry-After delay if the response has one. Requests waiting for the end of
+// the pause are released one after the other at the current rate, not all at
+// once. Each successful request then gives back a tenth of the configured
+// rate until it is reached again.
+type RateLimiter struct {
+	buckets map[OperationClass]*tokenBucket
+}
+
+// NewRateLimiter returns a limiter with the given budgets for reads, writes
+// and purge or preload submissions.
+func NewRateLimiter(read, write, content RateLimit) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{buckets: map[OperationClass]*tokenBucket{
+		OperationRead:    newTokenBucket(read, now),
+		OperationWrite:   newTokenBucket(write, now),
+		OperationContent: newTokenBucket(content, now),
+	}}
+}
+
+// Wait blocks until a request of class may be sent, or until ctx is done,
+// in which case it returns the context error and gives the reservation back.
+func (l *RateLimiter) Wait(ctx context.Context, class OperationClass) error {
+	b := l.buckets[class]
+	if b == nil {
+		return ctx.Err()
+	}
+	d := b.reserve(time.Now())
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// Observe adapts the rate of class to the response of a request.
+func (l *RateLimiter) Observe(class OperationClass, resp *http.Response, err error) {
+	b := l.buckets[class]
+	if b == nil || resp == nil {
+		return
+	}
+	if isThrottled(resp, err) {
+		b.slowDown(time.Now(), retryAfter(resp))
+	} else if resp.StatusCode < 400 {
+		b.recover()
+	}
+}
+
+// CurrentRate returns the rate of class after adaptation, 0 when unlimited.
+func (l *RateLimiter) CurrentRate(class OperationClass) float64 {
+	b := l.buckets[class]
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+func isThrottled(resp *http.Response, err error) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	var e *ErrorResponse
+	if errors.As(err, &e) && e.ErrorInfo != nil {
+		errType := strings.ToLower(e.ErrorInfo.Type)
+		return strings.Contains(errType, "throttl") || strings.Contains(errType, "toomanyrequests")
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	rate   float64 // Current rate, below limit.Rate after throttling
+	tokens float64
+	last   time.Time // Time tokens were counted at, the end of the pause while paused
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{limit: limit, rate: limit.Rate, tokens: float64(limit.Burst), last: now}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+// Tokens may go negative, queuing callers in arrival order. While the bucket
+// is paused no token is added, so queued callers are spaced at the rate from
+// the end of the pause.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if burst := float64(b.limit.Burst); b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	wait := b.last.Sub(now)
+	if b.tokens < 0 {
+		wait += time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return wait
+}
+
+// cancel gives back a token taken by reserve and not used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens++; b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+}
+
+func (b *tokenBucket) slowDown(now time.Time, pause time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate /= 2
+	if floor := b.limit.Rate / 16; b.rate < floor {
+		b.rate = floor
+	}
+	if b.tokens > 0 {
+		b.tokens = 0
+	}
+	if until := now.Add(pause); pause > 0 && until.After(b.last) {
+		b.last = until
+	}
+}
+
+func (b *tokenBucket) recover() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate += b.limit.Rate / 10; b.rate > b.limit.Rate {
+		b.rate = b.limit.Rate
+	}
+}
@@ -0,0 +1,104 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2}, now)
+	want := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, w := range want {
+		if got := b.reserve(now); got != w {
+			t.Errorf("reserve %d = %s, want %s", i, got, w)
+		}
+	}
+	// 300ms later the queue is drained and one token is back.
+	if got := b.reserve(now.Add(300 * time.Millisecond)); got != 0 {
+		t.Errorf("reserve after refill = %s, want 0", got)
+	}
+}
+
+func TestTokenBucketPauseStaggersRelease(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 5}, now)
+	b.slowDown(now, time.Second)
+	if b.rate != 5 {
+		t.Errorf("rate after throttling = %v, want 5", b.rate)
+	}
+	var previous time.Duration
+	for i := 0; i < 4; i++ {
+		got := b.reserve(now.Add(10 * time.Millisecond))
+		if got < time.Second-10*time.Millisecond {
+			t.Errorf("reserve %d = %s, before the end of the pause", i, got)
+		}
+		if i > 0 && got-previous != 200*time.Millisecond {
+			t.Errorf("reserve %d = %s, %s after the previous one, want 200ms", i, got, got-previous)
+		}
+		previous = got
+	}
+}
+
+func TestTokenBucketRecover(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 16}, now)
+	for i := 0; i < 6; i++ {
+		b.slowDown(now, 0)
+	}
+	if b.rate != 1 {
+		t.Errorf("rate = %v, want the floor of 1", b.rate)
+	}
+	for i := 0; i < 20; i++ {
+		b.recover()
+	}
+	if b.rate != 16 {
+		t.Errorf("rate = %v, want 16 after recovery", b.rate)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := NewRateLimiter(RateLimit{Rate: 0.001}, RateLimit{}, RateLimit{})
+	if err := l.Wait(context.Background(), OperationRead); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, OperationRead); err != context.DeadlineExceeded {
+		t.Errorf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if tokens := l.buckets[OperationRead].tokens; tokens < -0.1 {
+		t.Errorf("tokens = %v, the canceled reservation was not given back", tokens)
+	}
+	if err := l.Wait(context.Background(), OperationWrite); err != nil {
+		t.Errorf("Wait() of an unlimited class = %v", err)
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	succeeded := false
+	throttled := &ErrorResponse{Succeeded: &succeeded}
+	throttled.ErrorInfo = &struct {
+		Type    string
+		Message string
+	}{"RequestThrottled", "slow down"}
+	tests := []struct {
+		status int
+		err    error
+		want   bool
+	}{
+		{http.StatusTooManyRequests, nil, true},
+		{http.StatusOK, nil, false},
+		{http.StatusBadRequest, throttled, true},
+		{http.StatusBadRequest, fmt.Errorf("purge: %w", throttled), true},
+		{http.StatusBadRequest, fmt.Errorf("purge failed"), false},
+	}
+	for _, tt := range tests {
+		if got := isThrottled(&http.Response{StatusCode: tt.status}, tt.err); got != tt.want {
+			t.Errorf("isThrottled(%d, %v) = %v, want %v", tt.status, tt.err, got, tt.want)
+		}
+	}
+}
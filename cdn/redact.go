@@ -0,0 +1,116 @@
+package cdn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RedactedValue replaces secrets in logs and dumps.
+const RedactedValue = "REDACTED"
+
+// sensitiveFields are the JSON fields whose values never appear in logs and
+// dumps, compared case-insensitively.
+var sensitiveFields = []string{"PrivateKey", "KeyValue", "Authorization"}
+
+func isSensitiveField(name string) bool {
+	for _, f := range sensitiveFields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactJSON returns data with the values of the PrivateKey, KeyValue and
+// Authorization fields replaced by RedactedValue, at any depth and in any
+// case. Data that is not JSON is returned as is.
+func RedactJSON(data []byte) []byte {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return data
+	}
+	if !redactValue(v) {
+		return data
+	}
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// redactValue masks sensitive fields in a decoded JSON value and reports
+// whether anything was masked.
+func redactValue(v any) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isSensitiveField(key) {
+				if value != nil && value != "" {
+					v[key] = RedactedValue
+					changed = true
+				}
+				continue
+			}
+			changed = redactValue(value) || changed
+		}
+	case []any:
+		for _, item := range v {
+			changed = redactValue(item) || changed
+		}
+	}
+	return changed
+}
+
+// redactHeaders flattens h for logging, keeping only the key ID of the
+// Authorization header.
+func redactHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for name := range h {
+		value := h.Get(name)
+		if name == "Authorization" {
+			value = redactAuthorization(value)
+		} else if isSensitiveField(name) {
+			value = RedactedValue
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+// Secret is a string that never prints: String, GoString, every fmt verb
+// and MarshalJSON show RedactedValue, so logging or dumping a value holding
+// one is safe. Use string(s) where the plain value is needed.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return RedactedValue
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("cdn.Secret(%q)", s.String())
+}
+
+func (s Secret) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		io.WriteString(f, s.GoString())
+		return
+	}
+	io.WriteString(f, s.String())
+}
+
+// MarshalJSON encodes RedactedValue, or an empty string for an empty
+// secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
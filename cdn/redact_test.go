@@ -0,0 +1,51 @@
+package cdn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"top level", `{"KeyID":"id","KeyValue":"key"}`, `{"KeyID":"id","KeyValue":"REDACTED"}`},
+		{"nested and listed", `{"Items":[{"privatekey":"pem"},{"Name":"a"}],"Outer":{"Authorization":"sig"}}`,
+			`{"Items":[{"privatekey":"REDACTED"},{"Name":"a"}],"Outer":{"Authorization":"REDACTED"}}`},
+		{"numbers kept", `{"PrivateKey":"pem","Size":12345678901234567890}`, `{"PrivateKey":"REDACTED","Size":12345678901234567890}`},
+		{"empty and null secrets kept", `{"KeyValue":"","PrivateKey":null}`, `{"KeyValue":"","PrivateKey":null}`},
+		{"unchanged bytes", `{ "Name": "a" }`, `{ "Name": "a" }`},
+		{"not JSON", `KeyValue=key`, `KeyValue=key`},
+		{"empty", ``, ``},
+	}
+	for _, tt := range tests {
+		if got := string(RedactJSON([]byte(tt.in))); got != tt.want {
+			t.Errorf("%s: RedactJSON(%s) = %s, want %s", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSecret(t *testing.T) {
+	creds := Credentials{KeyID: "id", KeyValue: "s3cr3t"}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		if out := fmt.Sprintf(format, creds); strings.Contains(out, "s3cr3t") || strings.Contains(out, "733363723374") {
+			t.Errorf("Sprintf(%q) = %s, shows the key value", format, out)
+		}
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"KeyID":"id","KeyValue":"REDACTED"}`; string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+	if data, _ = json.Marshal(Secret("")); string(data) != `""` {
+		t.Errorf("json of an empty secret = %s", data)
+	}
+	var decoded Credentials
+	if err = json.Unmarshal([]byte(`{"KeyID":"id","KeyValue":"s3cr3t"}`), &decoded); err != nil || string(decoded.KeyValue) != "s3cr3t" {
+		t.Errorf("decoded %+v, %v, want the plain key value", decoded, err)
+	}
+}
@@ -0,0 +1,119 @@
+package cdn
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Validate reports configuration errors the API would reject.
+func (rc RefererControl) Validate() error {
+	if !rc.Enabled {
+		return nil
+	}
+	switch rc.RefererControlType {
+	case RefererControlTypeAllowList, RefererControlTypeBlockList:
+	default:
+		return fmt.Errorf("unknown referer control type %q", rc.RefererControlType)
+	}
+	if len(rc.PathPatterns) == 0 {
+		return fmt.Errorf("referer control is enabled without path patterns")
+	}
+	return nil
+}
+
+// RefererDecision is the outcome of evaluating a request against a RefererControl.
+type RefererDecision struct {
+	Allowed            bool
+	MatchedPathPattern string // Path pattern that put the request under control, empty if none
+	MatchedReferer     string // Referer entry matching the Referer header, empty if none
+}
+
+// Evaluate tells whether the CDN would serve requestPath to a request carrying
+// the given Referer header.
+//
+// Requests outside every PathPatterns entry are always allowed. For controlled
+// paths an AllowList only lets matching referers through and a BlockList
+// rejects them. A missing Referer header never matches a referer entry.
+//
+// Path patterns may use "*" to match any run of characters, including "/".
+// Referer entries are matched against the Referer host, or against host and
+// path when the entry contains a "/"; they may use "*" as well, e.g.
+// "*.example.com".
+//
+// Configurations rejected by Validate, such as an unknown control type, are
+// not evaluated and return its error.
+func (rc RefererControl) Evaluate(requestPath, referer string) (RefererDecision, error) {
+	if err := rc.Validate(); err != nil {
+		return RefererDecision{}, err
+	}
+	if !rc.Enabled {
+		return RefererDecision{Allowed: true}, nil
+	}
+	var decision RefererDecision
+	for _, pattern := range rc.PathPatterns {
+		if wildcardMatch(pattern, requestPath) {
+			decision.MatchedPathPattern = pattern
+			break
+		}
+	}
+	if decision.MatchedPathPattern == "" {
+		decision.Allowed = true
+		return decision, nil
+	}
+	decision.MatchedReferer = matchReferer(rc.Referers, referer)
+	if rc.RefererControlType == RefererControlTypeAllowList {
+		decision.Allowed = decision.MatchedReferer != ""
+	} else {
+		decision.Allowed = decision.MatchedReferer == ""
+	}
+	return decision, nil
+}
+
+func matchReferer(entries []string, referer string) string {
+	if referer == "" {
+		return ""
+	}
+	host, hostPath := referer, referer
+	if u, err := url.Parse(referer); err == nil && u.Host != "" {
+		host = u.Hostname()
+		hostPath = u.Host + u.EscapedPath()
+	}
+	host, hostPath = strings.ToLower(host), strings.ToLower(hostPath)
+	for _, entry := range entries {
+		e := strings.ToLower(entry)
+		if i := strings.Index(e, "://"); i >= 0 {
+			e = e[i+3:]
+		}
+		if strings.Contains(e, "/") {
+			if wildcardMatch(e, hostPath) {
+				return entry
+			}
+		} else if wildcardMatch(e, host) {
+			return entry
+		}
+	}
+	return ""
+}
+
+// wildcardMatch matches s against pattern where "*" stands for any sequence
+// of characters.
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
@@ -0,0 +1,58 @@
+package cdn
+
+import "testing"
+
+func TestRefererControlEvaluate(t *testing.T) {
+	allow := RefererControl{
+		Enabled:            true,
+		PathPatterns:       []string{"/images/*", "/downloads/*.zip"},
+		Referers:           []string{"*.example.com", "partner.example.net/shop/*"},
+		RefererControlType: RefererControlTypeAllowList,
+	}
+	block := allow
+	block.RefererControlType = RefererControlTypeBlockList
+
+	for _, tt := range []struct {
+		name           string
+		rc             RefererControl
+		path, referer  string
+		allowed        bool
+		pattern, entry string
+	}{
+		{"disabled", RefererControl{}, "/images/a.png", "", true, "", ""},
+		{"uncontrolled path", allow, "/index.html", "https://evil.example.org/", true, "", ""},
+		{"allow list match", allow, "/images/a.png", "https://www.example.com/page", true, "/images/*", "*.example.com"},
+		{"allow list case insensitive", allow, "/images/a.png", "https://WWW.Example.COM/", true, "/images/*", "*.example.com"},
+		{"allow list miss", allow, "/images/a.png", "https://evil.example.org/", false, "/images/*", ""},
+		{"allow list without referer", allow, "/images/a.png", "", false, "/images/*", ""},
+		{"wildcard spans slashes", allow, "/images/2023/01/a.png", "https://cdn.example.com/", true, "/images/*", "*.example.com"},
+		{"pattern suffix", allow, "/downloads/app.exe", "", true, "", ""},
+		{"host and path entry", allow, "/downloads/app.zip", "https://partner.example.net/shop/item", true, "/downloads/*.zip", "partner.example.net/shop/*"},
+		{"host and path entry miss", allow, "/downloads/app.zip", "https://partner.example.net/blog/", false, "/downloads/*.zip", ""},
+		{"block list match", block, "/images/a.png", "https://www.example.com/", false, "/images/*", "*.example.com"},
+		{"block list miss", block, "/images/a.png", "https://other.example.org/", true, "/images/*", ""},
+		{"block list without referer", block, "/images/a.png", "", true, "/images/*", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rc.Evaluate(tt.path, tt.referer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (RefererDecision{tt.allowed, tt.pattern, tt.entry}); got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRefererControlEvaluateInvalid(t *testing.T) {
+	for _, rc := range []RefererControl{
+		{Enabled: true, PathPatterns: []string{"/*"}, RefererControlType: "Unknown"},
+		{Enabled: true, PathPatterns: []string{"/*"}},
+		{Enabled: true, RefererControlType: RefererControlTypeBlockList},
+	} {
+		if got, err := rc.Evaluate("/a", "https://example.com/"); err == nil {
+			t.Errorf("%+v: got %+v, want an error", rc, got)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type SubscriptionRollupRequest struct {
+	StartTime   time.Time
+	EndTime     time.Time
+	Granularity Granularity // Volume granularity, PerHour when empty
+	TopN        int         // Number of TopDomains, 10 when zero
+	Concurrency int         // Endpoints queried at the same time, 4 when zero
+}
+
+// DomainContribution is the share of one endpoint in the subscription traffic.
+type DomainContribution struct {
+	EndpointID            string
+	DomainName            string
+	ServiceType           string
+	TotalCDNVolumeInMB    int64
+	TotalOriginVolumeInMB int64
+	PeakBandwidthInMbps   int64
+	VolumePercent         float64 // Share of the subscription CDN volume, 0 to 100
+}
+
+// SubscriptionRollup sums the traffic of every endpoint of the subscription.
+type SubscriptionRollup struct {
+	StartTime             time.Time
+	EndTime               time.Time
+	Granularity           Granularity
+	Bandwidth             []BandwidthPoint // Sum of all endpoints, per five minutes
+	Volume                []VolumePoint    // Sum of all endpoints, per Granularity
+	PeakBandwidthInMbps   int64
+	TotalCDNVolumeInMB    int64
+	TotalOriginVolumeInMB int64
+	Domains               []DomainContribution // All endpoints, by decreasing volume
+	TopDomains            []DomainContribution // First TopN of Domains
+}
+
+// QuerySubscriptionRollup fetches the bandwidth and volume of all endpoints
+// from ListEndpoints and combines them. Timestamps are aligned to the data
+// point grid before summing, so endpoints reporting slightly different
+// timestamps add up in the same point.
+//
+// Each endpoint query is itself split into windows, so up to
+// Concurrency times Client.TrafficQueryConcurrency requests may be in flight.
+func (c *Client) QuerySubscriptionRollup(ctx context.Context, req *SubscriptionRollupRequest) (*SubscriptionRollup, error) {
+	granularity := req.Granularity
+	if granularity == "" {
+		granularity = GranularityPerHour
+	}
+	if err := granularity.Validate(); err != nil {
+		return nil, err
+	}
+	topN := req.TopN
+	if topN <= 0 {
+		topN = 10
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	_, endpoints, err := c.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []Endpoint
+	if endpoints != nil {
+		list = *endpoints
+	}
+	bandwidth := make([]*BandwidthSeries, len(list))
+	volume := make([]*VolumeSeries, len(list))
+	err = parallelFor(ctx, len(list), concurrency, func(ctx context.Context, i int) (err error) {
+		id := list[i].EndpointID
+		if bandwidth[i], err = c.QueryBandwidth(ctx, &GetEndpointBandwidthRequest{
+			EndpointId: id,
+			StartTime:  req.StartTime,
+			EndTime:    req.EndTime,
+		}); err != nil {
+			return fmt.Errorf("bandwidth of %s: %w", id, err)
+		}
+		if volume[i], err = c.QueryVolume(ctx, &GetEndpointVolumeRequest{
+			EndpointID:  id,
+			Granularity: granularity,
+			StartTime:   req.StartTime,
+			EndTime:     req.EndTime,
+		}); err != nil {
+			return fmt.Errorf("volume of %s: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rollup := &SubscriptionRollup{StartTime: req.StartTime.UTC(), EndTime: req.EndTime.UTC(), Granularity: granularity}
+	bandwidthSum := map[time.Time]*BandwidthPoint{}
+	volumeSum := map[time.Time]*VolumePoint{}
+	for i, endpoint := range list {
+		domain := DomainContribution{
+			EndpointID:  endpoint.EndpointID,
+			DomainName:  endpoint.Settings.CustomDomain,
+			ServiceType: endpoint.Settings.ServiceType,
+		}
+		for _, item := range bandwidth[i].Items {
+			t := item.Time.Truncate(GranularityPerFiveMinutes.Step())
+			p := bandwidthSum[t]
+			if p == nil {
+				p = &BandwidthPoint{Time: t}
+				bandwidthSum[t] = p
+			}
+			p.BandwidthInMbps += item.BandwidthInMbps
+			p.OriginBandwidthInMbps += item.OriginBandwidthInMbps
+		}
+		for _, item := range volume[i].Items {
+			t := item.Time.Truncate(granularity.Step())
+			p := volumeSum[t]
+			if p == nil {
+				p = &VolumePoint{Time: t}
+				volumeSum[t] = p
+			}
+			p.VolumeInMB += item.VolumeInMB
+			p.OriginVolumeInMB += item.OriginVolumeInMB
+		}
+		domain.PeakBandwidthInMbps = bandwidth[i].PeakBandwidthInMbps
+		domain.TotalCDNVolumeInMB = volume[i].TotalCDNVolumeInMB
+		domain.TotalOriginVolumeInMB = volume[i].TotalOriginVolumeInMB
+		rollup.TotalCDNVolumeInMB += domain.TotalCDNVolumeInMB
+		rollup.TotalOriginVolumeInMB += domain.TotalOriginVolumeInMB
+		rollup.Domains = append(rollup.Domains, domain)
+	}
+
+	for _, p := range bandwidthSum {
+		rollup.Bandwidth = append(rollup.Bandwidth, *p)
+		if p.BandwidthInMbps > rollup.PeakBandwidthInMbps {
+			rollup.PeakBandwidthInMbps = p.BandwidthInMbps
+		}
+	}
+	sort.Slice(rollup.Bandwidth, func(i, j int) bool { return rollup.Bandwidth[i].Time.Before(rollup.Bandwidth[j].Time) })
+	for _, p := range volumeSum {
+		rollup.Volume = append(rollup.Volume, *p)
+	}
+	sort.Slice(rollup.Volume, func(i, j int) bool { return rollup.Volume[i].Time.Before(rollup.Volume[j].Time) })
+
+	for i := range rollup.Domains {
+		if rollup.TotalCDNVolumeInMB > 0 {
+			rollup.Domains[i].VolumePercent = float64(rollup.Domains[i].TotalCDNVolumeInMB) * 100 / float64(rollup.TotalCDNVolumeInMB)
+		}
+	}
+	sort.SliceStable(rollup.Domains, func(i, j int) bool {
+		return rollup.Domains[i].TotalCDNVolumeInMB > rollup.Domains[j].TotalCDNVolumeInMB
+	})
+	rollup.TopDomains = rollup.Domains
+	if len(rollup.TopDomains) > topN {
+		rollup.TopDomains = rollup.TopDomains[:topN]
+	}
+	return rollup, nil
+}
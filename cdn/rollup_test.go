@@ -0,0 +1,142 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rollupServer serves ListEndpoints and the traffic of each endpoint from
+// fixed responses, recording the requested volume granularities.
+type rollupServer struct {
+	bandwidth map[string]string // Endpoint ID -> response
+	volume    map[string]string
+
+	mu            sync.Mutex
+	granularities []string
+}
+
+func (s *rollupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/subscriptions/sub/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "endpoints":
+		w.Write([]byte(`[{"EndpointID":"ep-a","Settings":{"CustomDomain":"a.example.cn"}},` +
+			`{"EndpointID":"ep-b","Settings":{"CustomDomain":"b.example.cn","ServiceType":"Web"}}]`))
+	case len(parts) == 3 && parts[2] == "bandwidth":
+		w.Write([]byte(s.bandwidth[parts[1]]))
+	case len(parts) == 3 && parts[2] == "volume":
+		s.mu.Lock()
+		s.granularities = append(s.granularities, r.URL.Query().Get("granularity"))
+		s.mu.Unlock()
+		w.Write([]byte(s.volume[parts[1]]))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestQuerySubscriptionRollup(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	bandwidth := map[string]string{
+		"ep-a": `{"Items":[{"Timestamp":"2023-01-01T00:00:00Z","BandwidthInMbps":10,"OriginBandwidthInMbps":1},` +
+			`{"Timestamp":"2023-01-01T00:05:00Z","BandwidthInMbps":20,"OriginBandwidthInMbps":2}]}`,
+		// Slightly off timestamps are added to the point of their grid.
+		"ep-b": `{"Items":[{"Timestamp":"2023-01-01T00:01:00Z","BandwidthInMbps":5},` +
+			`{"Timestamp":"2023-01-01T00:05:30Z","BandwidthInMbps":1}]}`,
+	}
+	volume := map[string]string{
+		"ep-a": `{"Items":[{"Timestamp":"2023-01-01T00:00:00Z","VolumeInMB":100,"OriginVolumeInMB":10}]}`,
+		"ep-b": `{"Items":[{"Timestamp":"2023-01-01T00:00:30Z","VolumeInMB":300,"OriginVolumeInMB":30}]}`,
+	}
+	failure := `{"Succeeded":false,"ErrorInfo":{"Type":"InternalError","Message":"failure"}}`
+
+	tests := []struct {
+		name              string
+		req               SubscriptionRollupRequest
+		volume            map[string]string
+		wantErr           string
+		wantGranularities []string
+		want              *SubscriptionRollup
+	}{
+		{
+			name:              "sums endpoints",
+			req:               SubscriptionRollupRequest{TopN: 1},
+			wantGranularities: []string{"PerHour", "PerHour"},
+			want: &SubscriptionRollup{
+				Granularity: GranularityPerHour,
+				Bandwidth: []BandwidthPoint{
+					{Time: at(0), BandwidthInMbps: 15, OriginBandwidthInMbps: 1},
+					{Time: at(5 * time.Minute), BandwidthInMbps: 21, OriginBandwidthInMbps: 2},
+				},
+				Volume:                []VolumePoint{{Time: at(0), VolumeInMB: 400, OriginVolumeInMB: 40}},
+				PeakBandwidthInMbps:   21,
+				TotalCDNVolumeInMB:    400,
+				TotalOriginVolumeInMB: 40,
+				Domains: []DomainContribution{
+					{EndpointID: "ep-b", DomainName: "b.example.cn", ServiceType: "Web", TotalCDNVolumeInMB: 300, TotalOriginVolumeInMB: 30, PeakBandwidthInMbps: 5, VolumePercent: 75},
+					{EndpointID: "ep-a", DomainName: "a.example.cn", TotalCDNVolumeInMB: 100, TotalOriginVolumeInMB: 10, PeakBandwidthInMbps: 20, VolumePercent: 25},
+				},
+				TopDomains: []DomainContribution{
+					{EndpointID: "ep-b", DomainName: "b.example.cn", ServiceType: "Web", TotalCDNVolumeInMB: 300, TotalOriginVolumeInMB: 30, PeakBandwidthInMbps: 5, VolumePercent: 75},
+				},
+			},
+		},
+		{
+			name:              "requested granularity",
+			req:               SubscriptionRollupRequest{Granularity: GranularityPerDay},
+			wantGranularities: []string{"PerDay", "PerDay"},
+		},
+		{
+			name:    "endpoint failure",
+			volume:  map[string]string{"ep-a": volume["ep-a"], "ep-b": failure},
+			wantErr: "volume of ep-b: InternalError: failure",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &rollupServer{bandwidth: bandwidth, volume: volume}
+			if tt.volume != nil {
+				s.volume = tt.volume
+			}
+			client := newTestClient(t, s)
+
+			req := tt.req
+			req.StartTime, req.EndTime = start, start.Add(time.Hour)
+			got, err := client.QuerySubscriptionRollup(context.Background(), &req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			// A failure cancels the queries of the other endpoints.
+			if tt.wantErr == "" && !reflect.DeepEqual(s.granularities, tt.wantGranularities) {
+				t.Errorf("volume granularities = %q, want %q", s.granularities, tt.wantGranularities)
+			}
+			if tt.want == nil {
+				return
+			}
+			tt.want.StartTime, tt.want.EndTime = req.StartTime, req.EndTime
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rollup =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuerySubscriptionRollupInvalidGranularity(t *testing.T) {
+	client, requests := newRecordingClient(t, `[]`)
+	_, err := client.QuerySubscriptionRollup(context.Background(), &SubscriptionRollupRequest{Granularity: "PerWeek"})
+	if !errors.Is(err, ErrInvalidTrafficQuery) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidTrafficQuery)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("%d requests sent, want none", len(*requests))
+	}
+}
@@ -0,0 +1,176 @@
+package cdn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TrafficCache stores traffic statistics of closed time windows, which never
+// change once the period is over. Set Client.TrafficCache to make
+// QueryBandwidth and QueryVolume only call the API for missing or still open
+// windows.
+type TrafficCache interface {
+	// Get decodes the entry stored under key into value and reports whether
+	// it was found.
+	Get(key string, value any) (bool, error)
+	Put(key string, value any) error
+}
+
+// DefaultTrafficCacheSettleDelay is how long after its end a window is
+// considered closed unless Client.TrafficCacheSettleDelay is set. Statistics
+// of the last minutes keep being updated by the CDN.
+const DefaultTrafficCacheSettleDelay = 2 * time.Hour
+
+// trafficCacheUnit is the grid cached windows are aligned to, so the same
+// windows are reused whatever the queried range is. Each unit fits in
+// DefaultMaxTrafficQueryRange; a shorter Client.MaxTrafficQueryRange shrinks
+// it.
+var trafficCacheUnit = map[Granularity]time.Duration{
+	GranularityPerFiveMinutes: 24 * time.Hour,
+	GranularityPerHour:        7 * 24 * time.Hour,
+	GranularityPerDay:         28 * 24 * time.Hour,
+}
+
+type trafficWindow struct {
+	TimeWindow
+	cacheKey string // Empty when the window must not be cached
+}
+
+// trafficWindows splits a query range into windows to fetch. Without a cache
+// they are the fewest windows of Client.MaxTrafficQueryRange; with a cache, closed windows span
+// whole grid units and may extend beyond the range.
+func (c *Client) trafficWindows(endpointID, metric string, g Granularity, start, end time.Time) []trafficWindow {
+	var windows []trafficWindow
+	if c.TrafficCache == nil {
+		for _, w := range SplitTimeRange(start, end, c.maxTrafficQueryRange(g), g.Step()) {
+			windows = append(windows, trafficWindow{TimeWindow: w})
+		}
+		return windows
+	}
+	start, end = start.UTC(), end.UTC()
+	unit := trafficCacheUnit[g]
+	if max := c.maxTrafficQueryRange(g).Truncate(g.Step()); max > 0 && max < unit {
+		unit = max
+	}
+	settleDelay := c.TrafficCacheSettleDelay
+	if settleDelay <= 0 {
+		settleDelay = DefaultTrafficCacheSettleDelay
+	}
+	closedBefore := time.Now().Add(-settleDelay)
+	// Keys are scoped to the API host and subscription, so clients of other
+	// subscriptions or test servers sharing the cache never read each other's
+	// entries.
+	base := c.MakeRequestUrl("", nil)
+	host := base.Host
+	for ws := start.Truncate(unit); ws.Before(end); ws = ws.Add(unit) {
+		we := ws.Add(unit)
+		if !we.After(closedBefore) {
+			windows = append(windows, trafficWindow{
+				TimeWindow: TimeWindow{ws, we},
+				cacheKey: fmt.Sprintf("%s/%s/%s/%s-%s-%d-%d", url.QueryEscape(host), url.PathEscape(c.SubscriptionID),
+					url.PathEscape(endpointID), metric, g, ws.Unix(), we.Unix()),
+			})
+			continue
+		}
+		w := TimeWindow{ws, we}
+		if w.Start.Before(start) {
+			w.Start = start
+		}
+		if w.End.After(end) {
+			w.End = end
+		}
+		if w.Start.Before(w.End) {
+			windows = append(windows, trafficWindow{TimeWindow: w})
+		}
+	}
+	return windows
+}
+
+// cachedTrafficRequest serves a window from the cache when possible and
+// stores closed windows fetched from the API. Cache failures never fail the
+// query.
+func (c *Client) cachedTrafficRequest(w trafficWindow, result any, fetch func() error) error {
+	if w.cacheKey != "" {
+		if found, err := c.TrafficCache.Get(w.cacheKey, result); err == nil && found {
+			return nil
+		}
+	}
+	if err := fetch(); err != nil {
+		return err
+	}
+	if w.cacheKey != "" {
+		_ = c.TrafficCache.Put(w.cacheKey, result)
+	}
+	return nil
+}
+
+// FileTrafficCache is a TrafficCache storing one JSON file per window under
+// Dir.
+type FileTrafficCache struct {
+	Dir string
+}
+
+// NewFileTrafficCache returns a cache in dir, by default in the user cache
+// directory.
+func NewFileTrafficCache(dir string) (*FileTrafficCache, error) {
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userCache, "azure-cn", "cdn-traffic")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileTrafficCache{Dir: dir}, nil
+}
+
+func (f *FileTrafficCache) path(key string) string {
+	return filepath.Join(f.Dir, filepath.FromSlash(key)+".json")
+}
+
+func (f *FileTrafficCache) Get(key string, value any) (bool, error) {
+	data, err := os.ReadFile(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err = json.Unmarshal(data, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Put writes the entry to a temporary file first so concurrent readers never
+// see a partial entry.
+func (f *FileTrafficCache) Put(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	path := f.path(key)
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,218 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrafficWindowsGrid(t *testing.T) {
+	client := NewClient("id", "key", "sub")
+	client.TrafficCache = &FileTrafficCache{Dir: t.TempDir()}
+	start := time.Date(2023, 1, 3, 5, 30, 0, 0, time.UTC)
+	end := time.Date(2023, 1, 20, 7, 0, 0, 0, time.UTC)
+	unit := trafficCacheUnit[GranularityPerHour]
+	windows := client.trafficWindows("ep", "volume", GranularityPerHour, start, end)
+	if len(windows) == 0 || windows[0].Start.After(start) || windows[len(windows)-1].End.Before(end) {
+		t.Fatalf("windows %+v do not cover %s..%s", windows, start, end)
+	}
+	for i, w := range windows {
+		if !w.Start.Equal(w.Start.Truncate(unit)) || w.End.Sub(w.Start) != unit {
+			t.Errorf("window %d %s..%s is not a grid unit", i, w.Start, w.End)
+		}
+		if w.cacheKey == "" {
+			t.Errorf("closed window %d not cached", i)
+		}
+		if i > 0 && !w.Start.Equal(windows[i-1].End) {
+			t.Errorf("window %d starts at %s, want %s", i, w.Start, windows[i-1].End)
+		}
+	}
+
+	// A shorter MaxTrafficQueryRange shrinks the grid unit.
+	client.MaxTrafficQueryRange = map[Granularity]time.Duration{GranularityPerHour: 2 * 24 * time.Hour}
+	for _, w := range client.trafficWindows("ep", "volume", GranularityPerHour, start, end) {
+		if w.End.Sub(w.Start) != 2*24*time.Hour {
+			t.Errorf("window %s..%s, want 2 days", w.Start, w.End)
+		}
+	}
+}
+
+// trafficCacheServer counts the volume requests of each window.
+type trafficCacheServer struct {
+	mu       sync.Mutex
+	requests map[string]int // "start end" -> count
+}
+
+func (s *trafficCacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s.mu.Lock()
+	s.requests[q.Get("startTime")+" "+q.Get("endTime")]++
+	s.mu.Unlock()
+	fmt.Fprintf(w, `{"Items":[{"Timestamp":%q,"VolumeInMB":1}]}`, q.Get("startTime"))
+}
+
+func (s *trafficCacheServer) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, count := range s.requests {
+		n += count
+	}
+	return n
+}
+
+func newTrafficCacheClient(t *testing.T) (*Client, *trafficCacheServer) {
+	t.Helper()
+	s := &trafficCacheServer{requests: map[string]int{}}
+	client := newTestClient(t, s)
+	cache, err := NewFileTrafficCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.TrafficCache = cache
+	return client, s
+}
+
+func TestTrafficCacheOverlappingRanges(t *testing.T) {
+	client, s := newTrafficCacheClient(t)
+	query := func(start, end time.Time) {
+		t.Helper()
+		if _, err := client.QueryVolume(context.Background(), &GetEndpointVolumeRequest{
+			EndpointID: "ep", Granularity: GranularityPerHour, StartTime: start, EndTime: end,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unit := trafficCacheUnit[GranularityPerHour]
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Truncate(unit)
+
+	query(base.Add(time.Hour), base.Add(2*unit-time.Hour))
+	if n := s.total(); n != 2 {
+		t.Fatalf("%d requests for two units, want 2", n)
+	}
+	// Only the unit not covered by the first range is fetched.
+	query(base.Add(unit+time.Hour), base.Add(3*unit-time.Hour))
+	if n := s.total(); n != 3 {
+		t.Errorf("%d requests after an overlapping range, want 3", n)
+	}
+	for window, count := range s.requests {
+		if count != 1 {
+			t.Errorf("window %s fetched %d times", window, count)
+		}
+	}
+}
+
+func TestTrafficCacheRefetchesOpenWindows(t *testing.T) {
+	client, s := newTrafficCacheClient(t)
+	client.TrafficCacheSettleDelay = time.Hour
+	end := time.Now().UTC()
+	start := end.Add(-3 * 24 * time.Hour)
+	windows := client.trafficWindows("ep", "volume", GranularityPerFiveMinutes, start, end)
+	var closed, open int
+	for _, w := range windows {
+		if w.cacheKey == "" {
+			open++
+			if w.End.After(end) {
+				t.Errorf("open window %s..%s extends beyond the range", w.Start, w.End)
+			}
+		} else {
+			closed++
+			if w.End.After(end.Add(-client.TrafficCacheSettleDelay)) {
+				t.Errorf("window %s..%s cached before it settled", w.Start, w.End)
+			}
+		}
+	}
+	if closed == 0 || open == 0 {
+		t.Fatalf("%d closed and %d open windows, want both", closed, open)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, err := client.QueryVolume(context.Background(), &GetEndpointVolumeRequest{
+			EndpointID: "ep", Granularity: GranularityPerFiveMinutes, StartTime: start, EndTime: end,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if want := closed + i*open; s.total() != want {
+			t.Errorf("%d requests after query %d, want %d", s.total(), i, want)
+		}
+	}
+}
+
+func TestFileTrafficCachePut(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileTrafficCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "host/sub/ep/volume-PerHour-1-2"
+	var got GetEndpointVolumeResponse
+	if found, err := cache.Get(key, &got); err != nil || found {
+		t.Fatalf("Get of a missing entry = %v, %v", found, err)
+	}
+
+	// Readers never see a partially written entry while it is replaced.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			value := GetEndpointVolumeResponse{DomainName: strings.Repeat("x", 1+i*1000), TotalCDNVolumeInMB: int64(i)}
+			if err := cache.Put(key, &value); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			var value GetEndpointVolumeResponse
+			if _, err := cache.Get(key, &value); err != nil {
+				t.Errorf("Get during Put: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if found, err := cache.Get(key, &got); err != nil || !found || got.TotalCDNVolumeInMB != 49 {
+		t.Errorf("Get = %v, %v, %+v, want the last entry", found, err, got.TotalCDNVolumeInMB)
+	}
+	entries, err := os.ReadDir(filepath.Dir(cache.path(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("cache directory holds %q, want only the entry", names)
+	}
+}
+
+func TestTrafficCacheKey(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	keyOf := func(c *Client) string {
+		c.TrafficCache = &FileTrafficCache{Dir: t.TempDir()}
+		return c.trafficWindows("ep", "volume", GranularityPerHour, start, start.Add(time.Hour))[0].cacheKey
+	}
+	got := keyOf(NewClient("id", "key", "sub-1"))
+	if want := "restapi.cdn.azure.cn/sub-1/ep/volume-PerHour-1672012800-1672617600"; got != want {
+		t.Errorf("key = %s, want %s", got, want)
+	}
+	if other := keyOf(NewClient("id", "key", "sub-2")); other == got {
+		t.Error("same key for another subscription")
+	}
+	otherHost := NewClient("id", "key", "sub-1")
+	otherHost.RestAPIEndpoint = "127.0.0.1:8080"
+	if other := keyOf(otherHost); other == got {
+		t.Error("same key for another API host")
+	}
+}
@@ -0,0 +1,279 @@
+package cdn
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxTrafficQueryRange returns the length of the windows QueryBandwidth
+// and QueryVolume split a range into for each granularity, or zero for an
+// unknown one. The API documentation states no limit: these sizes only keep
+// each response small, and GetEndpointBandwidth and GetEndpointVolume send
+// any range as is. Set Client.MaxTrafficQueryRange when the API requires
+// shorter windows. Bandwidth data is always returned per five minutes.
+func DefaultMaxTrafficQueryRange(g Granularity) time.Duration {
+	switch g {
+	case GranularityPerFiveMinutes:
+		return 24 * time.Hour
+	case GranularityPerHour:
+		return 31 * 24 * time.Hour
+	case GranularityPerDay:
+		return 366 * 24 * time.Hour
+	}
+	return 0
+}
+
+// DefaultTrafficQueryConcurrency is the number of windows fetched at the same
+// time by QueryBandwidth and QueryVolume unless
+// Client.TrafficQueryConcurrency is set.
+const DefaultTrafficQueryConcurrency = 4
+
+func (c *Client) maxTrafficQueryRange(g Granularity) time.Duration {
+	if max := c.MaxTrafficQueryRange[g]; max > 0 {
+		return max
+	}
+	return DefaultMaxTrafficQueryRange(g)
+}
+
+func (c *Client) trafficQueryConcurrency() int {
+	if c.TrafficQueryConcurrency > 0 {
+		return c.TrafficQueryConcurrency
+	}
+	return DefaultTrafficQueryConcurrency
+}
+
+// Step returns the length of one data point.
+func (g Granularity) Step() time.Duration {
+	switch g {
+	case GranularityPerHour:
+		return time.Hour
+	case GranularityPerDay:
+		return 24 * time.Hour
+	default:
+		return 5 * time.Minute
+	}
+}
+
+// TimeWindow is a closed time interval.
+type TimeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// SplitTimeRange splits start..end into consecutive windows no longer than
+// max. Inner boundaries are aligned to step so data points are never cut in
+// two; adjacent windows share their boundary.
+func SplitTimeRange(start, end time.Time, max, step time.Duration) []TimeWindow {
+	start, end = start.UTC(), end.UTC()
+	if !start.Before(end) {
+		return []TimeWindow{{start, end}}
+	}
+	if step > 0 && max >= step {
+		max = max.Truncate(step)
+	}
+	var windows []TimeWindow
+	for cur := start; cur.Before(end); {
+		next := cur.Add(max)
+		if step > 0 {
+			next = next.Truncate(step)
+		}
+		if !next.After(cur) {
+			next = cur.Add(max)
+		}
+		if next.After(end) {
+			next = end
+		}
+		windows = append(windows, TimeWindow{cur, next})
+		cur = next
+	}
+	return windows
+}
+
+type BandwidthPoint struct {
+	Time                  time.Time
+	BandwidthInMbps       int64
+	OriginBandwidthInMbps int64
+}
+
+// BandwidthSeries is the bandwidth of one endpoint over an arbitrary range.
+type BandwidthSeries struct {
+	EndpointID                  string
+	DomainName                  string
+	StartTime                   time.Time
+	EndTime                     time.Time
+	Items                       []BandwidthPoint
+	PeakBandwidthInMbps         int64 //CDN bandwidth peak value
+	ValleyBandwidthInMbps       int64 //CDN bandwidth trough value
+	PeakOriginBandwidthInMbps   int64 //Return-to-source bandwidth peak value
+	ValleyOriginBandwidthInMbps int64 //Return-to-source bandwidth trough value
+}
+
+type VolumePoint struct {
+	Time             time.Time
+	VolumeInMB       int64 //CDN traffic
+	OriginVolumeInMB int64 //Back to source traffic
+}
+
+// VolumeSeries is the traffic of one endpoint over an arbitrary range.
+type VolumeSeries struct {
+	EndpointID            string
+	DomainName            string
+	Granularity           Granularity
+	StartTime             time.Time
+	EndTime               time.Time
+	Items                 []VolumePoint
+	TotalCDNVolumeInMB    int64 //CDN total traffic
+	TotalOriginVolumeInMB int64 //Back to source total traffic
+}
+
+// QueryBandwidth is GetEndpointBandwidth for long ranges: the range is split
+// into windows of Client.MaxTrafficQueryRange fetched concurrently, and peak
+// and valley values are recomputed over the merged series; items without a
+// timestamp are dropped. Closed windows are read from and written to
+// Client.TrafficCache when set.
+func (c *Client) QueryBandwidth(ctx context.Context, req *GetEndpointBandwidthRequest) (*BandwidthSeries, error) {
+	windows := c.trafficWindows(req.EndpointId, "bandwidth", GranularityPerFiveMinutes, req.StartTime, req.EndTime)
+	results := make([]*GetEndpointBandwidthResponse, len(windows))
+	err := parallelFor(ctx, len(windows), c.trafficQueryConcurrency(), func(ctx context.Context, i int) error {
+		return c.cachedTrafficRequest(windows[i], &results[i], func() (err error) {
+			_, results[i], err = c.GetEndpointBandwidth(ctx, &GetEndpointBandwidthRequest{
+				EndpointId: req.EndpointId,
+				StartTime:  windows[i].Start,
+				EndTime:    windows[i].End,
+			})
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	series := &BandwidthSeries{EndpointID: req.EndpointId, StartTime: req.StartTime.UTC(), EndTime: req.EndTime.UTC()}
+	seen := map[time.Time]bool{}
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if series.DomainName == "" {
+			series.DomainName = result.DomainName
+		}
+		for _, item := range result.Items {
+			if item.Timestamp.IsZero() || seen[item.Timestamp] || item.Timestamp.Before(series.StartTime) || item.Timestamp.After(series.EndTime) {
+				continue
+			}
+			seen[item.Timestamp] = true
+			series.Items = append(series.Items, BandwidthPoint{item.Timestamp, item.BandwidthInMbps, item.OriginBandwidthInMbps})
+		}
+	}
+	sort.Slice(series.Items, func(i, j int) bool { return series.Items[i].Time.Before(series.Items[j].Time) })
+	for i, item := range series.Items {
+		if i == 0 || item.BandwidthInMbps > series.PeakBandwidthInMbps {
+			series.PeakBandwidthInMbps = item.BandwidthInMbps
+		}
+		if i == 0 || item.BandwidthInMbps < series.ValleyBandwidthInMbps {
+			series.ValleyBandwidthInMbps = item.BandwidthInMbps
+		}
+		if i == 0 || item.OriginBandwidthInMbps > series.PeakOriginBandwidthInMbps {
+			series.PeakOriginBandwidthInMbps = item.OriginBandwidthInMbps
+		}
+		if i == 0 || item.OriginBandwidthInMbps < series.ValleyOriginBandwidthInMbps {
+			series.ValleyOriginBandwidthInMbps = item.OriginBandwidthInMbps
+		}
+	}
+	return series, nil
+}
+
+// QueryVolume is GetEndpointVolume for long ranges: the range is split into
+// windows of Client.MaxTrafficQueryRange fetched concurrently, and totals are
+// recomputed over the merged series; items without a timestamp are dropped.
+// Closed windows are read from and written to Client.TrafficCache when set.
+func (c *Client) QueryVolume(ctx context.Context, req *GetEndpointVolumeRequest) (*VolumeSeries, error) {
+	if err := req.Granularity.Validate(); err != nil {
+		return nil, err
+	}
+	windows := c.trafficWindows(req.EndpointID, "volume", req.Granularity, req.StartTime, req.EndTime)
+	results := make([]*GetEndpointVolumeResponse, len(windows))
+	err := parallelFor(ctx, len(windows), c.trafficQueryConcurrency(), func(ctx context.Context, i int) error {
+		return c.cachedTrafficRequest(windows[i], &results[i], func() (err error) {
+			_, results[i], err = c.GetEndpointVolume(ctx, &GetEndpointVolumeRequest{
+				EndpointID:  req.EndpointID,
+				Granularity: req.Granularity,
+				StartTime:   windows[i].Start,
+				EndTime:     windows[i].End,
+			})
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	series := &VolumeSeries{EndpointID: req.EndpointID, Granularity: req.Granularity,
+		StartTime: req.StartTime.UTC(), EndTime: req.EndTime.UTC()}
+	seen := map[time.Time]bool{}
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if series.DomainName == "" {
+			series.DomainName = result.DomainName
+		}
+		for _, item := range result.Items {
+			if item.Timestamp.IsZero() || seen[item.Timestamp] || item.Timestamp.Before(series.StartTime) || item.Timestamp.After(series.EndTime) {
+				continue
+			}
+			seen[item.Timestamp] = true
+			series.Items = append(series.Items, VolumePoint{item.Timestamp, item.VolumeInMB, item.OriginVolumeInMB})
+			series.TotalCDNVolumeInMB += item.VolumeInMB
+			series.TotalOriginVolumeInMB += item.OriginVolumeInMB
+		}
+	}
+	sort.Slice(series.Items, func(i, j int) bool { return series.Items[i].Time.Before(series.Items[j].Time) })
+	return series, nil
+}
+
+// parallelFor calls fn for every index below n with at most concurrency
+// calls in flight and returns the first error. After an error, or once ctx is
+// done, no further call is started and the context of running calls is
+// canceled.
+func parallelFor(ctx context.Context, n, concurrency int, fn func(ctx context.Context, i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+	)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		return parent.Err()
+	}
+	return firstErr
+}
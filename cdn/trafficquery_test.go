@@ -0,0 +1,62 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallelForStopsAfterError(t *testing.T) {
+	var calls atomic.Int64
+	failure := errors.New("failure")
+	err := parallelFor(context.Background(), 100, 1, func(ctx context.Context, i int) error {
+		calls.Add(1)
+		if i == 2 {
+			return failure
+		}
+		return nil
+	})
+	if err != failure {
+		t.Errorf("err = %v, want %v", err, failure)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d calls, want 3", n)
+	}
+}
+
+func TestParallelForCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	if err := parallelFor(ctx, 10, 2, func(ctx context.Context, i int) error {
+		called = true
+		return nil
+	}); err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if called {
+		t.Error("fn called with a canceled context")
+	}
+}
+
+func TestMaxTrafficQueryRange(t *testing.T) {
+	client, requests := newRecordingClient(t, `{}`)
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	req := &GetEndpointVolumeRequest{EndpointID: "ep", Granularity: GranularityPerHour, StartTime: start, EndTime: start.Add(62 * 24 * time.Hour)}
+	if _, err := client.QueryVolume(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 2 {
+		t.Errorf("%d requests with the default range, want 2", len(*requests))
+	}
+	*requests = nil
+	client.MaxTrafficQueryRange = map[Granularity]time.Duration{GranularityPerHour: 7 * 24 * time.Hour}
+	if _, err := client.QueryVolume(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 9 {
+		t.Errorf("%d requests with a 7 day range, want 9", len(*requests))
+	}
+}
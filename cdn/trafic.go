@@ -1,6 +1,9 @@
 package cdn
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -9,44 +12,63 @@ import (
 
 // Get bandwidth information
 // https://docs.azure.cn/en-us/cdn/cdn-api-get-endpoint-bandwidth
-func (c *Client) GetEndpointBandwidth(req *GetEndpointBandwidthRequest) (resp *http.Response, result *GetEndpointBandwidthResponse, err error) {
+func (c *Client) GetEndpointBandwidth(ctx context.Context, req *GetEndpointBandwidthRequest) (resp *http.Response, result *GetEndpointBandwidthResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/bandwidth?apiVersion=1.0", req.EndpointId), url.Values{
-		"startTime": {req.StartTime.UTC().Format("2006-01-02T15:04:05Z")},
-		"endTime":   {req.EndTime.UTC().Format("2006-01-02T15:04:05Z")},
+		"startTime": {formatTrafficTime(req.StartTime)},
+		"endTime":   {formatTrafficTime(req.EndTime)},
 	})
-	resp, err = c.Request(http.MethodGet, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodGet, reqUrl, nil, &result)
 	return resp, result, err
 }
 
 type GetEndpointBandwidthRequest struct {
 	EndpointId string    //Target node unique identifier
-	StartTime  time.Time //The bandwidth query start time must be a UTC time in the 'yyyy-MM-ddThh:mm:ssZ’ format.
-	EndTime    time.Time //The bandwidth query end time must be a UTC time in the 'yyyy-MM-ddThh:mm:ssZ’ format.
+	StartTime  time.Time //The bandwidth query start time, converted to UTC
+	EndTime    time.Time //The bandwidth query end time, converted to UTC
 }
 
 type GetEndpointBandwidthResponse struct {
-	DomainName string
-	Items      []struct {
+	DomainName                  string
+	Items                       []GetEndpointBandwidthItem
+	PeakBandwidthInMbps         int64 //CDN bandwidth peak value
+	ValleyBandwidthInMbps       int64 //CDN bandwidth trough value
+	PeakOriginBandwidthInMbps   int64 //Return-to-source bandwidth peak value
+	ValleyOriginBandwidthInMbps int64 //Return-to-source bandwidth trough value
+}
+
+type GetEndpointBandwidthItem struct {
+	Timestamp             time.Time //Start of the five minute period in UTC, zero when missing
+	BandwidthInMbps       int64
+	OriginBandwidthInMbps int64
+}
+
+func (i *GetEndpointBandwidthItem) UnmarshalJSON(data []byte) error {
+	var raw struct {
 		Timestamp             string
 		BandwidthInMbps       int64
 		OriginBandwidthInMbps int64
 	}
-	PeakBandwidthInMbps         int64 //CDN bandwidth peak value
-	ValleyBandwidthInMbps       int64 //CDN bandwidth trough value
-	PeakOriginBandwidthInMbps   int64 //Return-to-source bandwidth peak value
-	ValleyOriginBandwidthInMbps int64 //eturn-to-source bandwidth trough value
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	t, err := ParseTrafficTimestamp(raw.Timestamp)
+	if err != nil {
+		return err
+	}
+	*i = GetEndpointBandwidthItem{t, raw.BandwidthInMbps, raw.OriginBandwidthInMbps}
+	return nil
 }
 
 // Get traffic information
 // https://docs.azure.cn/en-us/cdn/cdn-api-get-endpoint-volume
-func (c *Client) GetEndpointVolume(req *GetEndpointVolumeRequest) (resp *http.Response, result *GetEndpointVolumeResponse, err error) {
+func (c *Client) GetEndpointVolume(ctx context.Context, req *GetEndpointVolumeRequest) (resp *http.Response, result *GetEndpointVolumeResponse, err error) {
 	reqUrl := c.MakeRequestUrl(fmt.Sprintf("/endpoints/%s/volume?apiVersion=1.0", req.EndpointID), url.Values{
-		"granularity": {req.Granularity},
-		"startTime":   {req.StartTime.Format("2006-01-02T15:04:05Z")},
-		"endTime":     {req.EndTime.Format("2006-01-02T15:04:05Z")},
+		"granularity": {string(req.Granularity)},
+		"startTime":   {formatTrafficTime(req.StartTime)},
+		"endTime":     {formatTrafficTime(req.EndTime)},
 	})
 
-	resp, err = c.Request(http.MethodGet, reqUrl, nil, &result)
+	resp, err = c.Request(ctx, http.MethodGet, reqUrl, nil, &result)
 	return resp, result, err
 }
 
@@ -59,20 +81,85 @@ const (
 	GranularityPerDay         Granularity = "PerDay"         //Per day
 )
 
+// Validate reports whether g is a known granularity.
+func (g Granularity) Validate() error {
+	switch g {
+	case GranularityPerFiveMinutes, GranularityPerHour, GranularityPerDay:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown granularity %q", ErrInvalidTrafficQuery, g)
+}
+
+var ErrInvalidTrafficQuery = errors.New("invalid traffic query")
+
+// ValidateTrafficRange checks that g is known and start is before end.
+// GetEndpointBandwidth and GetEndpointVolume leave such checks to the API;
+// callers wanting an early error can use this first.
+func ValidateTrafficRange(g Granularity, start, end time.Time) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	if !start.Before(end) {
+		return fmt.Errorf("%w: start time %s is not before end time %s", ErrInvalidTrafficQuery,
+			formatTrafficTime(start), formatTrafficTime(end))
+	}
+	return nil
+}
+
+// Query times must be UTC in the yyyy-MM-ddThh:mm:ssZ format.
+func formatTrafficTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// ParseTrafficTimestamp parses the Timestamp of traffic items. The API
+// documentation does not state the zone of returned timestamps; those without
+// one are assumed to be UTC like the query times, and every result is
+// converted to UTC. An empty timestamp parses as the zero time.
+func ParseTrafficTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid traffic timestamp %q", s)
+}
+
 type GetEndpointVolumeRequest struct {
-	EndpointID  string    //Target node unique identifier
-	Granularity string    //Traffic statistic granularity
-	StartTime   time.Time //The traffic query start time must be a UTC time in the 'yyyy-MM-ddThh:mm:ssZ’ format.
-	EndTime     time.Time //The traffic query end time must be a UTC time in the 'yyyy-MM-ddThh:mm:ssZ’ format.
+	EndpointID  string      //Target node unique identifier
+	Granularity Granularity //Traffic statistic granularity
+	StartTime   time.Time   //The traffic query start time, converted to UTC
+	EndTime     time.Time   //The traffic query end time, converted to UTC
 }
 
 type GetEndpointVolumeResponse struct {
-	DomainName string //Accelerated domain names
-	Items      []struct {
-		Timestamp        string
-		VolumeInMB       int64 //CDN traffic
-		OriginVolumeInMB int64 //Back to source traffic
-	}
+	DomainName            string //Accelerated domain names
+	Items                 []GetEndpointVolumeItem
 	TotalCDNVolumeInMB    int64 //CDN total traffic
 	TotalOriginVolumeInMB int64 //Back to source total traffic
 }
+
+type GetEndpointVolumeItem struct {
+	Timestamp        time.Time //Start of the period in UTC, zero when missing
+	VolumeInMB       int64     //CDN traffic
+	OriginVolumeInMB int64     //Back to source traffic
+}
+
+func (i *GetEndpointVolumeItem) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Timestamp        string
+		VolumeInMB       int64
+		OriginVolumeInMB int64
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	t, err := ParseTrafficTimestamp(raw.Timestamp)
+	if err != nil {
+		return err
+	}
+	*i = GetEndpointVolumeItem{t, raw.VolumeInMB, raw.OriginVolumeInMB}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseTrafficTimestamp(t *testing.T) {
+	want := time.Date(2023, 1, 1, 8, 5, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2023-01-01T08:05:00Z", want},
+		{"2023-01-01T16:05:00+08:00", want},
+		{"2023-01-01T08:05:00", want},
+		{"2023-01-01 08:05:00", want},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTrafficTimestamp(tt.in)
+		if err != nil {
+			t.Errorf("ParseTrafficTimestamp(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("ParseTrafficTimestamp(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseTrafficTimestamp("yesterday"); err == nil {
+		t.Error("ParseTrafficTimestamp(yesterday) succeeded")
+	}
+}
+
+func TestTrafficItemsWithoutTimestamp(t *testing.T) {
+	var bandwidth GetEndpointBandwidthResponse
+	data := `{"Items":[{"Timestamp":"2023-01-01T00:00:00Z","BandwidthInMbps":5},{"Timestamp":"","BandwidthInMbps":6},{"BandwidthInMbps":7}]}`
+	if err := json.Unmarshal([]byte(data), &bandwidth); err != nil {
+		t.Fatal(err)
+	}
+	if len(bandwidth.Items) != 3 || bandwidth.Items[0].Timestamp.IsZero() || !bandwidth.Items[1].Timestamp.IsZero() || !bandwidth.Items[2].Timestamp.IsZero() {
+		t.Errorf("bandwidth items = %+v", bandwidth.Items)
+	}
+
+	var volume GetEndpointVolumeResponse
+	data = `{"Items":[{"VolumeInMB":1},{"Timestamp":"2023-01-01T01:00:00Z","VolumeInMB":2}]}`
+	if err := json.Unmarshal([]byte(data), &volume); err != nil {
+		t.Fatal(err)
+	}
+	if len(volume.Items) != 2 || !volume.Items[0].Timestamp.IsZero() || volume.Items[1].VolumeInMB != 2 {
+		t.Errorf("volume items = %+v", volume.Items)
+	}
+}
+
+func TestQueryVolumeDropsItemsWithoutTimestamp(t *testing.T) {
+	client, _ := newRecordingClient(t, `{"DomainName":"cdn.example.cn","Items":[`+
+		`{"Timestamp":"2023-01-01T00:00:00Z","VolumeInMB":2,"OriginVolumeInMB":1},`+
+		`{"Timestamp":"","VolumeInMB":100,"OriginVolumeInMB":100}]}`)
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	series, err := client.QueryVolume(context.Background(), &GetEndpointVolumeRequest{
+		EndpointID:  "ep1",
+		Granularity: GranularityPerHour,
+		StartTime:   start,
+		EndTime:     start.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series.Items) != 1 || series.TotalCDNVolumeInMB != 2 || series.TotalOriginVolumeInMB != 1 {
+		t.Errorf("series = %+v", series)
+	}
+}
@@ -0,0 +1,221 @@
+// Package urlsign generates and verifies time-limited signed URLs for CDN
+// URL authentication.
+//
+// Three token formats are supported, all based on an MD5 digest of the
+// private key, the request path and a timestamp:
+//
+//	Type A: http://DomainName/FileName?auth_key=timestamp-rand-uid-md5hash
+//	        md5hash = md5("/FileName-timestamp-rand-uid-PrivateKey")
+//	        timestamp is a decimal Unix time
+//	Type B: http://DomainName/timestamp/md5hash/FileName
+//	        md5hash = md5("PrivateKey" + "timestamp" + "/FileName")
+//	        timestamp is formatted as YYYYMMDDHHMM in UTC+8
+//	Type C: http://DomainName/md5hash/timestamp/FileName
+//	        md5hash = md5("PrivateKey" + "/FileName" + "timestamp")
+//	        timestamp is a hexadecimal Unix time
+package urlsign
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URL authentication type
+type Type string
+
+const (
+	TypeA Type = "A" //Token in the auth_key query parameter
+	TypeB Type = "B" //Timestamp and token as leading path segments
+	TypeC Type = "C" //Token and hexadecimal timestamp as leading path segments
+)
+
+var (
+	ErrMalformed        = errors.New("urlsign: URL does not carry a token")
+	ErrInvalidSignature = errors.New("urlsign: signature does not match")
+	ErrExpired          = errors.New("urlsign: URL has expired")
+)
+
+// chinaTime is the time zone of Type B timestamps.
+var chinaTime = time.FixedZone("UTC+8", 8*60*60)
+
+// Signer signs and verifies URLs for one CDN endpoint.
+//
+// To rotate keys, configure the new key on the CDN as the backup key, move
+// the old one to PreviousKeys and set Key to the new one: links signed before
+// the switch keep verifying until they expire.
+type Signer struct {
+	Type         Type
+	Key          string        // Key used for signing
+	PreviousKeys []string      // Keys still accepted by Verify
+	TTL          time.Duration // Validity period after the signing time, as configured on the CDN
+	UID          string        // Type A user ID, "0" when empty
+	Rand         string        // Type A random value, "0" when empty
+
+	Now func() time.Time // time.Now when nil
+}
+
+func (s *Signer) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// Sign returns rawURL with a token for signing time t. A zero t means now.
+func (s *Signer) Sign(rawURL string, t time.Time) (string, error) {
+	if s.Key == "" {
+		return "", errors.New("urlsign: empty key")
+	}
+	if t.IsZero() {
+		t = s.now()
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	switch s.Type {
+	case TypeA:
+		if strings.Contains(s.rand(), "-") {
+			return "", errors.New("urlsign: rand must not contain \"-\"")
+		}
+		timestamp := strconv.FormatInt(t.Unix(), 10)
+		query := u.Query()
+		query.Set("auth_key", fmt.Sprintf("%s-%s-%s-%s", timestamp, s.rand(), s.uid(),
+			hashA(s.Key, path, timestamp, s.rand(), s.uid())))
+		u.RawQuery = query.Encode()
+	case TypeB:
+		timestamp := t.In(chinaTime).Format("200601021504")
+		u.Path = "/" + timestamp + "/" + hashB(s.Key, path, timestamp) + path
+		u.RawPath = ""
+	case TypeC:
+		timestamp := strconv.FormatInt(t.Unix(), 16)
+		u.Path = "/" + hashC(s.Key, path, timestamp) + "/" + timestamp + path
+		u.RawPath = ""
+	default:
+		return "", fmt.Errorf("urlsign: unknown type %q", s.Type)
+	}
+	return u.String(), nil
+}
+
+// Verify checks the token of a signed URL against Key and PreviousKeys and
+// returns the URL with the token removed.
+func (s *Signer) Verify(signedURL string) (string, error) {
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		return "", err
+	}
+	var (
+		path, timestamp, digest string
+		signedAt                time.Time
+		hash                    func(key string) string
+	)
+	switch s.Type {
+	case TypeA:
+		query := u.Query()
+		var rnd, uid string
+		if timestamp, rnd, uid, digest, err = splitAuthKey(query.Get("auth_key")); err != nil {
+			return "", err
+		}
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return "", ErrMalformed
+		}
+		path, signedAt = u.Path, time.Unix(sec, 0)
+		hash = func(key string) string { return hashA(key, path, timestamp, rnd, uid) }
+		query.Del("auth_key")
+		u.RawQuery = query.Encode()
+	case TypeB, TypeC:
+		segments := strings.SplitN(u.Path, "/", 4)
+		if len(segments) < 4 || segments[0] != "" {
+			return "", ErrMalformed
+		}
+		path = "/" + segments[3]
+		if s.Type == TypeB {
+			timestamp, digest = segments[1], segments[2]
+			if signedAt, err = time.ParseInLocation("200601021504", timestamp, chinaTime); err != nil {
+				return "", ErrMalformed
+			}
+			hash = func(key string) string { return hashB(key, path, timestamp) }
+		} else {
+			digest, timestamp = segments[1], segments[2]
+			sec, err := strconv.ParseInt(timestamp, 16, 64)
+			if err != nil {
+				return "", ErrMalformed
+			}
+			signedAt = time.Unix(sec, 0)
+			hash = func(key string) string { return hashC(key, path, timestamp) }
+		}
+		u.Path, u.RawPath = path, ""
+	default:
+		return "", fmt.Errorf("urlsign: unknown type %q", s.Type)
+	}
+
+	valid := false
+	for _, key := range append([]string{s.Key}, s.PreviousKeys...) {
+		if key != "" && subtle.ConstantTimeCompare([]byte(hash(key)), []byte(strings.ToLower(digest))) == 1 {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", ErrInvalidSignature
+	}
+	if s.TTL > 0 && s.now().After(signedAt.Add(s.TTL)) {
+		return "", ErrExpired
+	}
+	return u.String(), nil
+}
+
+func (s *Signer) uid() string {
+	if s.UID == "" {
+		return "0"
+	}
+	return s.UID
+}
+
+func (s *Signer) rand() string {
+	if s.Rand == "" {
+		return "0"
+	}
+	return s.Rand
+}
+
+// splitAuthKey splits a Type A token, timestamp-rand-uid-md5hash. The
+// timestamp, rand and hash never contain "-", the UID may.
+func splitAuthKey(authKey string) (timestamp, rnd, uid, digest string, err error) {
+	timestamp, rest, ok1 := strings.Cut(authKey, "-")
+	rnd, rest, ok2 := strings.Cut(rest, "-")
+	i := strings.LastIndex(rest, "-")
+	if !ok1 || !ok2 || i <= 0 || timestamp == "" || rnd == "" || i == len(rest)-1 {
+		return "", "", "", "", ErrMalformed
+	}
+	return timestamp, rnd, rest[:i], rest[i+1:], nil
+}
+
+func hashA(key, path, timestamp, rnd, uid string) string {
+	return md5Hex(fmt.Sprintf("%s-%s-%s-%s-%s", path, timestamp, rnd, uid, key))
+}
+
+func hashB(key, path, timestamp string) string {
+	return md5Hex(key + timestamp + path)
+}
+
+func hashC(key, path, timestamp string) string {
+	return md5Hex(key + path + timestamp)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
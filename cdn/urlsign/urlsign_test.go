@@ -0,0 +1,107 @@
+package urlsign
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var signedAt = time.Unix(1672531200, 0) // 2023-01-01 08:00 UTC+8
+
+func TestSignKnownTokens(t *testing.T) {
+	for _, tt := range []struct {
+		signer Signer
+		want   string
+	}{
+		{Signer{Type: TypeA, Key: "secret", UID: "user-42"},
+			"http://cdn.example.com/video/a.mp4?auth_key=1672531200-0-user-42-d47536cd43146b492598048aac1d12db"},
+		{Signer{Type: TypeB, Key: "secret"},
+			"http://cdn.example.com/202301010800/9d4f1c9b895dcc81a96dc8c36b2958d0/video/a.mp4"},
+		{Signer{Type: TypeC, Key: "secret"},
+			"http://cdn.example.com/47d08251fb942ab75dfc54a9725606a3/63b0cd00/video/a.mp4"},
+	} {
+		t.Run(string(tt.signer.Type), func(t *testing.T) {
+			got, err := tt.signer.Sign("http://cdn.example.com/video/a.mp4", signedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	for _, typ := range []Type{TypeA, TypeB, TypeC} {
+		t.Run(string(typ), func(t *testing.T) {
+			now := signedAt.Add(10 * time.Minute)
+			s := &Signer{Type: typ, Key: "secret", TTL: time.Hour, UID: "a-b-c", Rand: "42", Now: func() time.Time { return now }}
+			signed, err := s.Sign("https://cdn.example.com/dir/file.js?v=2", signedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Verify(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "https://cdn.example.com/dir/file.js?v=2"; got != want {
+				t.Errorf("Verify = %s, want %s", got, want)
+			}
+
+			now = signedAt.Add(2 * time.Hour)
+			if _, err = s.Verify(signed); !errors.Is(err, ErrExpired) {
+				t.Errorf("expired link: err = %v, want %v", err, ErrExpired)
+			}
+			now = signedAt
+
+			other := *s
+			other.Key = "other"
+			if _, err = other.Verify(signed); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("other key: err = %v, want %v", err, ErrInvalidSignature)
+			}
+			tampered := strings.Replace(signed, "file.js", "other.js", 1)
+			if _, err = s.Verify(tampered); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("tampered path: err = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := &Signer{Type: TypeA, Key: "old-key", Now: func() time.Time { return signedAt }}
+	signed, err := old.Sign("http://cdn.example.com/a.png", signedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := &Signer{Type: TypeA, Key: "new-key", PreviousKeys: []string{"old-key"}, Now: old.Now}
+	if _, err = rotated.Verify(signed); err != nil {
+		t.Errorf("link signed with the previous key: %v", err)
+	}
+	rotated.PreviousKeys = nil
+	if _, err = rotated.Verify(signed); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("previous key dropped: err = %v, want %v", err, ErrInvalidSignature)
+	}
+	fresh, _ := rotated.Sign("http://cdn.example.com/a.png", signedAt)
+	if _, err = rotated.Verify(fresh); err != nil {
+		t.Errorf("link signed with the new key: %v", err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	s := &Signer{Type: TypeA, Key: "secret"}
+	for _, u := range []string{
+		"http://cdn.example.com/a.png",
+		"http://cdn.example.com/a.png?auth_key=1672531200-0-d47536cd43146b492598048aac1d12db",
+		"http://cdn.example.com/a.png?auth_key=1672531200-0-0-",
+		"http://cdn.example.com/a.png?auth_key=now-0-0-d47536cd43146b492598048aac1d12db",
+	} {
+		if _, err := s.Verify(u); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: err = %v, want %v", u, err, ErrMalformed)
+		}
+	}
+	if _, err := (&Signer{Type: TypeA, Key: "secret", Rand: "1-2"}).Sign("http://cdn.example.com/a.png", signedAt); err == nil {
+		t.Error("rand containing - accepted")
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes
+const (
+	exitOK    = 0 //Success
+	exitError = 1 //The request or a local operation failed
+	exitUsage = 2 //Invalid command, flag or argument
+)
+
+// command is a node of the command tree: a group with subcommands or a leaf
+// with a run function.
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	details string // Printed below the summary in the help of the command
+	args    string // Positional arguments synopsis, e.g. "<endpoint-id>"
+	minArgs int
+	maxArgs int // -1 for no limit
+	hidden  bool
+	local   bool // Runs without credentials or API calls
+	sub     []*command
+
+	// setup registers the flags of a leaf command and returns its run
+	// function, which receives the positional arguments.
+	setup func(fs *flag.FlagSet) func(app *app, args []string) error
+}
+
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+
+func (e usageError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, a ...any) error {
+	return usageError{fmt.Errorf(format, a...)}
+}
+
+func (c *command) find(name string) *command {
+	for _, sub := range c.sub {
+		if sub.name == name {
+			return sub
+		}
+		for _, alias := range sub.aliases {
+			if alias == name {
+				return sub
+			}
+		}
+	}
+	return nil
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help" || arg == "help"
+}
+
+// execute resolves args against the tree below c and runs the leaf command.
+// path is the command line leading to c, used in help and errors.
+func (c *command) execute(app *app, path []string, args []string) error {
+	fs := flag.NewFlagSet(strings.Join(path, " "), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	app.addGlobalFlags(fs)
+
+	if c.setup == nil {
+		// Global flags may also precede the command name.
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				c.printHelp(app.stdout, path, fs)
+				return nil
+			}
+			c.printHelp(app.stderr, path, fs)
+			return usageError{fmt.Errorf("%s: %w", strings.Join(path, " "), err)}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			c.printHelp(app.stderr, path, fs)
+			return usageErrorf("%s: missing command", strings.Join(path, " "))
+		}
+		if isHelp(args[0]) {
+			c.printHelp(app.stdout, path, fs)
+			return nil
+		}
+		sub := c.find(args[0])
+		if sub == nil {
+			return usageErrorf("%s: unknown command %q, see '%s --help'", strings.Join(path, " "), args[0], strings.Join(path, " "))
+		}
+		return sub.execute(app, append(path, sub.name), args[1:])
+	}
+
+	run := c.setup(fs)
+
+	// Flags may appear before, between or after positional arguments, up to
+	// a "--" terminator.
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				c.printHelp(app.stdout, path, fs)
+				return nil
+			}
+			c.printHelp(app.stderr, path, fs)
+			return usageError{fmt.Errorf("%s: %w", strings.Join(path, " "), err)}
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		if n := len(args) - fs.NArg(); n > 0 && args[n-1] == "--" {
+			positional = append(positional, fs.Args()...)
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) < c.minArgs || (c.maxArgs >= 0 && len(positional) > c.maxArgs) {
+		c.printHelp(app.stderr, path, fs)
+		if c.args == "" {
+			return usageErrorf("%s: unexpected arguments %q", strings.Join(path, " "), positional)
+		}
+		return usageErrorf("%s: expected arguments %s, got %d", strings.Join(path, " "), c.args, len(positional))
+	}
+	if !c.local {
+		if err := app.connect(); err != nil {
+			return err
+		}
+	}
+	return run(app, positional)
+}
+
+func (c *command) printHelp(w io.Writer, path []string, fs *flag.FlagSet) {
+	name := strings.Join(path, " ")
+	if c.setup == nil {
+		fmt.Fprintf(w, "Usage: %s <command>\n", name)
+	} else {
+		fmt.Fprintf(w, "Usage: %s [flags] %s\n", name, c.args)
+	}
+	if c.summary != "" {
+		fmt.Fprintf(w, "\n%s\n", c.summary)
+	}
+	if c.details != "" {
+		fmt.Fprintf(w, "\n%s\n", c.details)
+	}
+	if len(c.sub) > 0 {
+		fmt.Fprint(w, "\nCommands:\n")
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		for _, sub := range c.sub {
+			if !sub.hidden {
+				fmt.Fprintf(tw, "  %s\t%s\n", sub.name, sub.summary)
+			}
+		}
+		tw.Flush()
+		fmt.Fprintf(w, "\nRun '%s <command> --help' for details.\n", name)
+	}
+	if fs != nil {
+		var names, global []string
+		fs.VisitAll(func(f *flag.Flag) {
+			if isGlobalFlag(f.Name) {
+				global = append(global, f.Name)
+			} else {
+				names = append(names, f.Name)
+			}
+		})
+		printFlags(w, "Flags", fs, names)
+		printFlags(w, "Global Flags", fs, global)
+	}
+}
+
+func printFlags(w io.Writer, title string, fs *flag.FlagSet, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "\n%s:\n", title)
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, n := range names {
+		f := fs.Lookup(n)
+		def := ""
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "[]" {
+			def = fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(tw, "  --%s\t%s%s\n", f.Name, f.Usage, def)
+	}
+	tw.Flush()
+}
+
+// stringsFlag collects a repeatable flag; comma separated values are split.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
+
+func stringsVar(fs *flag.FlagSet, name, usage string) *stringsFlag {
+	s := &stringsFlag{}
+	fs.Var(s, name, usage)
+	return s
+}
+
+// timeRangeFlags registers --start and --end and returns a function parsing
+// them once flags are parsed. The range defaults to the last defaultRange.
+func timeRangeFlags(fs *flag.FlagSet, defaultRange time.Duration) func() (start, end time.Time, err error) {
+	startFlag := fs.String("start", "", fmt.Sprintf("start time in RFC 3339, %s before end by default", defaultRange))
+	endFlag := fs.String("end", "", "end time in RFC 3339, now by default")
+	return func() (start, end time.Time, err error) {
+		end = time.Now()
+		if *endFlag != "" {
+			if end, err = time.Parse(time.RFC3339, *endFlag); err != nil {
+				return start, end, usageErrorf("invalid --end: %v", err)
+			}
+		}
+		start = end.Add(-defaultRange)
+		if *startFlag != "" {
+			if start, err = time.Parse(time.RFC3339, *startFlag); err != nil {
+				return start, end, usageErrorf("invalid --start: %v", err)
+			}
+		}
+		if !start.Before(end) {
+			return start, end, usageErrorf("--start must be before --end")
+		}
+		return start, end, nil
+	}
+}
+
+func readFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
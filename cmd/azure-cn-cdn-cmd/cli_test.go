@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCommandLine(t *testing.T) {
+	keys := []string{"--key-id", "id", "--key-value", "key", "--subscription-id", "sub"}
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		code       int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "missing command",
+			args:       []string{"endpoints"},
+			code:       exitUsage,
+			wantStderr: "endpoints: missing command",
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"endpoints", "rename"},
+			code:       exitUsage,
+			wantStderr: `unknown command "rename"`,
+		},
+		{
+			name:       "unknown flag",
+			args:       []string{"endpoints", "delete", "--force", "ep-1"},
+			code:       exitUsage,
+			wantStderr: "flag provided but not defined: -force",
+		},
+		{
+			name:       "global flag before the command",
+			args:       append([]string{"--output", "table", "top"}, keys...),
+			code:       exitUsage,
+			wantStderr: "top is interactive and does not support --output",
+		},
+		{
+			name:       "global flag between commands",
+			args:       append([]string{"traffic", "--output", "table", "export"}, keys...),
+			code:       exitUsage,
+			wantStderr: "traffic export does not support --output table",
+		},
+		{
+			name:       "profile before the command",
+			args:       []string{"--profile", "none", "endpoints", "list"},
+			code:       exitUsage,
+			wantStderr: `profile "none" not found`,
+		},
+		{
+			name:       "profile between commands",
+			args:       []string{"endpoints", "--profile", "none", "delete", "ep-1"},
+			code:       exitUsage,
+			wantStderr: `profile "none" not found`,
+		},
+		{
+			name:       "unknown flag before the command",
+			args:       []string{"--sort", "b", "top"},
+			code:       exitUsage,
+			wantStderr: "flag provided but not defined: -sort",
+		},
+		{
+			name:       "arguments after the terminator",
+			args:       []string{"endpoints", "delete", "--", "--ep-1", "ep-2"},
+			code:       exitUsage,
+			wantStderr: "expected arguments <endpoint-id>, got 2",
+		},
+		{
+			name:       "dry run with global flags before the command",
+			args:       []string{"--dry-run", "endpoints", "delete", "ep-1"},
+			wantStderr: "DELETE https://restapi.cdn.azure.cn/subscriptions/SUBSCRIPTION_ID/endpoints/ep-1?",
+		},
+		{
+			name:       "no result printed for a dry run",
+			args:       []string{"--dry-run", "--output", "table", "certs", "upload", "cert", certFile, certFile},
+			wantStderr: "POST https://restapi.cdn.azure.cn/subscriptions/SUBSCRIPTION_ID/https/certificates?",
+		},
+		{
+			name:       "dry run without credentials does not read",
+			args:       []string{"--dry-run", "access-control", "set", "ep-1", "--block", "192.0.2.1"},
+			code:       exitError,
+			wantStderr: "--dry-run without credentials cannot read the live state",
+		},
+		{
+			name:       "invalid sort column",
+			args:       append([]string{"top", "--sort", "x"}, keys...),
+			code:       exitUsage,
+			wantStderr: `invalid --sort "x"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AZURE_CN_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+			t.Setenv("AZURE_CN_PROFILE", "")
+			t.Setenv("AZURE_CN_SUBSCRIPTION_ID", "")
+			t.Setenv("AZURE_CN_CDN_KEY_ID", "")
+			t.Setenv("AZURE_CN_CDN_KEY_VALUE", "")
+			t.Setenv("AZURE_CN_CDN_TRAFFIC_CACHE", "")
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("exit code %d, want %d, stderr:\n%s", code, tt.code, stderr.String())
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr misses %q:\n%s", tt.wantStderr, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func rootCommand() *command {
+	endpoints := endpointsCommand()
+	certs := certsCommand()
+	traffic := trafficCommand()
+	return &command{
+		name:    "azure-cn-cdn-cmd",
+		summary: "Manage Azure China CDN endpoints, content, certificates and traffic.",
+		sub: []*command{
+			endpoints,
+			cacheCommand(),
+			purgeCommand(),
+			preloadCommand(),
+			operationsCommand(),
+			certs,
+			httpsCommand(),
+			accessControlCommand(),
+			traffic,
+			topCommand(),
+			signURLCommand(),
+			estimateBillCommand(),
+			configureCommand(),
+
+			// Names used by earlier releases
+			hiddenAlias(endpoints.find("list"), "list-endpoints"),
+			hiddenAlias(certs.find("upload"), "upload-https-certificate"),
+			hiddenAlias(traffic.find("export"), "export-traffic"),
+		},
+	}
+}
+
+func configureCommand() *command {
+	return &command{
+		name: "configure", summary: "Create or update a profile of the configuration file, prompting for values not given by flags",
+		local: true,
+		setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+			makeDefault := fs.Bool("default", false, "make the profile the default one")
+			return func(app *app, args []string) error {
+				creds := &app.credentials
+				if creds.configPath == "" {
+					return usageErrorf("cannot locate the home directory, set --config")
+				}
+				config, err := loadConfig(creds.configPath)
+				if err != nil {
+					return err
+				}
+				name := creds.profile
+				if name == "" {
+					name = defaultProfileName
+				}
+				profile := config.Profiles[name]
+				if profile == nil {
+					profile = &Profile{}
+					config.Profiles[name] = profile
+				}
+				in := bufio.NewReader(os.Stdin)
+				for _, field := range []struct {
+					label  string
+					flag   string
+					value  *string
+					secret bool
+				}{
+					{"Key ID", creds.keyID, &profile.KeyID, false},
+					{"Key value", creds.keyValue, &profile.KeyValue, true},
+					{"Subscription ID", creds.subscriptionID, &profile.SubscriptionID, false},
+				} {
+					if field.flag != "" {
+						*field.value = field.flag
+						continue
+					}
+					if *field.value, err = prompt(in, app, field.label, *field.value, field.secret); err != nil {
+						return err
+					}
+				}
+				if profile.KeyID == "" || profile.KeyValue == "" || profile.SubscriptionID == "" {
+					return usageErrorf("key ID, key value and subscription ID are required")
+				}
+				if *makeDefault || config.DefaultProfile == "" && len(config.Profiles) == 1 {
+					config.DefaultProfile = name
+				}
+				if err = config.save(creds.configPath); err != nil {
+					return err
+				}
+				fmt.Fprintf(app.stderr, "Saved profile %q to %s\n", name, creds.configPath)
+				return nil
+			}
+		},
+	}
+}
+
+func hiddenAlias(c *command, name string) *command {
+	alias := *c
+	alias.name, alias.aliases, alias.hidden = name, nil, true
+	return &alias
+}
+
+// endpointCommand builds a leaf taking a single endpoint ID.
+func endpointCommand(name, summary string, run func(app *app, endpointID string) error) *command {
+	return &command{
+		name: name, summary: summary, args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+		setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+			return func(app *app, args []string) error { return run(app, args[0]) }
+		},
+	}
+}
+
+func endpointsCommand() *command {
+	return &command{
+		name:    "endpoints",
+		summary: "Create, inspect and manage endpoints",
+		sub: []*command{
+			{
+				name: "list", aliases: []string{"ls"}, summary: "List all endpoints of the subscription",
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					return func(app *app, args []string) error {
+						resp, result, err := app.client.ListEndpoints(app.ctx)
+						return app.result(resp, result, err)
+					}
+				},
+			},
+			endpointCommand("get", "Get an endpoint", func(app *app, endpointID string) error {
+				resp, result, err := app.client.GetEndpoint(app.ctx, &cdn.GetEndpointRequest{EndpointID: endpointID})
+				return app.result(resp, result, err)
+			}),
+			{
+				name: "create", summary: "Create an endpoint",
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					domain := fs.String("domain", "", "accelerated domain name (required)")
+					host := fs.String("host", "", "return-to-source host header")
+					icp := fs.String("icp", "", "ICP record number (required)")
+					origins := stringsVar(fs, "origin", "return-to-source address, repeatable (required)")
+					serviceType := fs.String("service-type", string(cdn.ServiceTypeWeb), "acceleration type: Web, Download, VOD, LiveStreaming or ImageProcessing")
+					return func(app *app, args []string) error {
+						if *domain == "" || *icp == "" || len(*origins) == 0 {
+							return usageErrorf("--domain, --icp and --origin are required")
+						}
+						body := cdn.CreateEndpointRequestBody{
+							CustomDomain: *domain,
+							Host:         *host,
+							ICP:          *icp,
+							ServiceType:  cdn.ServiceType(*serviceType),
+						}
+						body.Origin.Addresses = *origins
+						resp, result, err := app.client.CreateEndpoint(app.ctx, body)
+						return app.result(resp, result, err)
+					}
+				},
+			},
+			endpointCommand("delete", "Delete an endpoint", func(app *app, endpointID string) error {
+				resp, result, err := app.client.DeleteEndpoint(app.ctx, &cdn.DeleteEndpointRequest{EndpointID: endpointID})
+				return app.result(resp, result, err)
+			}),
+			endpointCommand("enable", "Enable an endpoint", func(app *app, endpointID string) error {
+				resp, result, err := app.client.EnableEndpoint(app.ctx, &cdn.EnableEndpointRequest{EndpointID: endpointID})
+				return app.result(resp, result, err)
+			}),
+			endpointCommand("disable", "Disable an endpoint", func(app *app, endpointID string) error {
+				resp, result, err := app.client.DisableEndpoint(app.ctx, &cdn.DisableEndpointRequest{EndpointID: endpointID})
+				return app.result(resp, result, err)
+			}),
+			{
+				name: "update", summary: "Update the origin or the return-to-source host header of an endpoint",
+				args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					host := fs.String("host", "", "new return-to-source host header")
+					origins := stringsVar(fs, "origin", "new return-to-source address, repeatable")
+					return func(app *app, args []string) error {
+						if *host == "" && len(*origins) == 0 {
+							return usageErrorf("one of --host or --origin is required")
+						}
+						if *host != "" {
+							request := &cdn.UpdateEndpointRequest{EndpointID: args[0]}
+							request.Body.EndpointSettings.Host = host
+							request.Body.UpdateFlag = "HostHeader"
+							if err := app.result(app.client.UpdateEndpoint(app.ctx, request)); err != nil {
+								return err
+							}
+						}
+						if len(*origins) > 0 {
+							request := &cdn.UpdateEndpointRequest{EndpointID: args[0]}
+							request.Body.EndpointSettings.Origin = &struct {
+								Addresses []string
+							}{*origins}
+							request.Body.UpdateFlag = "Origin"
+							if err := app.result(app.client.UpdateEndpoint(app.ctx, request)); err != nil {
+								return err
+							}
+						}
+						return nil
+					}
+				},
+			},
+		},
+	}
+}
+
+func cacheCommand() *command {
+	return &command{
+		name:    "cache",
+		summary: "Get and set cache rules",
+		sub: []*command{
+			endpointCommand("get", "Get the cache rules of an endpoint", func(app *app, endpointID string) error {
+				resp, result, err := app.client.GetCachePolicy(app.ctx, &cdn.GetCachePolicyRequest{EndpointID: endpointID})
+				return app.result(resp, result, err)
+			}),
+			{
+				name: "set", summary: "Replace the cache rules of an endpoint",
+				args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					file := fs.String("file", "", "JSON cache policy file, - for stdin")
+					rules := stringsVar(fs, "rule", "cache rule as Type:item1;item2:TTL, e.g. Suffix:jpg;png:3600, repeatable")
+					ignoreCacheControl := fs.Bool("ignore-cache-control", false, "ignore the cache-control header of the origin")
+					ignoreCookie := fs.Bool("ignore-cookie", false, "ignore the set-cookie header of the origin")
+					ignoreQueryString := fs.Bool("ignore-query-string", false, "ignore query parameters when caching")
+					return func(app *app, args []string) error {
+						policy := &cdn.UpdateCachePolicyRequestBody{}
+						switch {
+						case *file != "" && len(*rules) > 0:
+							return usageErrorf("--file and --rule are mutually exclusive")
+						case *file != "":
+							data, err := readFile(*file)
+							if err != nil {
+								return err
+							}
+							if err = json.Unmarshal(data, policy); err != nil {
+								return fmt.Errorf("parse %s: %w", *file, err)
+							}
+						case len(*rules) > 0:
+							for _, r := range *rules {
+								rule, err := parseCacheRule(r)
+								if err != nil {
+									return usageError{err}
+								}
+								policy.Rules = append(policy.Rules, rule)
+							}
+							policy.IgnoreCacheControl = *ignoreCacheControl
+							policy.IgnoreCookie = *ignoreCookie
+							policy.IgnoreQueryString = *ignoreQueryString
+						default:
+							return usageErrorf("one of --file or --rule is required")
+						}
+						resp, result, err := app.client.UpdateCachePolicy(app.ctx, &cdn.UpdateCachePolicyRequest{EndpointID: args[0], Body: policy})
+						return app.result(resp, result, err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func parseCacheRule(s string) (cdn.CachePolicyRule, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return cdn.CachePolicyRule{}, fmt.Errorf("invalid cache rule %q, expected Type:items:TTL", s)
+	}
+	ttl, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return cdn.CachePolicyRule{}, fmt.Errorf("invalid TTL in cache rule %q: %w", s, err)
+	}
+	ruleType := cdn.CachePolicyRuleType(parts[0])
+	switch ruleType {
+	case cdn.CachePolicyRuleTypeSuffix, cdn.CachePolicyRuleTypeDir, cdn.CachePolicyRuleFullUri:
+	default:
+		return cdn.CachePolicyRule{}, fmt.Errorf("invalid cache rule type %q, expected Suffix, Dir or FullUri", parts[0])
+	}
+	return cdn.CachePolicyRule{Type: ruleType, Items: strings.Split(parts[1], ";"), TTL: ttl}, nil
+}
+
+func purgeCommand() *command {
+	return &command{
+		name:    "purge",
+		summary: "Refresh cached files and directories",
+		sub: []*command{
+			{
+				name: "add", summary: "Submit a cache refresh",
+				args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					files := stringsVar(fs, "file", "absolute URL of a file to refresh, repeatable")
+					dirs := stringsVar(fs, "dir", "absolute URL of a directory to refresh, repeatable")
+					return func(app *app, args []string) error {
+						if len(*files) == 0 && len(*dirs) == 0 {
+							return usageErrorf("at least one --file or --dir is required")
+						}
+						resp, result, err := app.client.AddPurge(app.ctx, &cdn.AddPurgeRequest{
+							EndpointID: args[0],
+							Body:       cdn.AddPurgeRequestBody{Files: *files, Directories: *dirs},
+						})
+						return app.result(resp, result, err)
+					}
+				},
+			},
+			{
+				name: "get", summary: "Check the progress of a cache refresh",
+				args: "<endpoint-id> <purge-id>", minArgs: 2, maxArgs: 2,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					return func(app *app, args []string) error {
+						resp, result, err := app.client.QueryPurge(app.ctx, &cdn.QueryPurgeRequest{EndpointID: args[0], PurgeID: args[1]})
+						return app.result(resp, result, err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func preloadCommand() *command {
+	return &command{
+		name:    "preload",
+		summary: "Prefetch files into the cache",
+		sub: []*command{
+			{
+				name: "add", summary: "Submit a prefetch",
+				args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					files := stringsVar(fs, "file", "absolute URL of a file to prefetch, repeatable (required)")
+					return func(app *app, args []string) error {
+						if len(*files) == 0 {
+							return usageErrorf("at least one --file is required")
+						}
+						resp, result, err := app.client.AddPreload(app.ctx, &cdn.AddPreloadRequest{
+							EndpointID: args[0],
+							Body:       cdn.AddPreloadRequestBody{Files: *files},
+						})
+						return app.result(resp, result, err)
+					}
+				},
+			},
+			{
+				name: "get", summary: "Check the progress of a prefetch",
+				args: "<endpoint-id> <preload-id>", minArgs: 2, maxArgs: 2,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					return func(app *app, args []string) error {
+						resp, result, err := app.client.QueryPreload(app.ctx, &cdn.QueryPreloadRequest{EndpointID: args[0], PreloadID: args[1]})
+						return app.result(resp, result, err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func operationsCommand() *command {
+	return &command{
+		name:    "operations",
+		summary: "Inspect asynchronous operations",
+		sub: []*command{
+			{
+				name: "get", summary: "Get the status of an operation",
+				args: "<endpoint-id> <operation-id>", minArgs: 2, maxArgs: 2,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					return func(app *app, args []string) error {
+						resp, result, err := app.client.GetOperation(app.ctx, &cdn.GetOperationRequest{EndpointID: args[0], OperationID: args[1]})
+						return app.result(resp, result, err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func certsCommand() *command {
+	return &command{
+		name:    "certs",
+		summary: "Manage HTTPS certificates",
+		sub: []*command{
+			{
+				name: "upload", summary: "Upload a PEM certificate and its private key",
+				args: "<name> <certificate-path> <private-key-path>", minArgs: 3, maxArgs: 3,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					return func(app *app, args []string) error {
+						pubCert, err := os.ReadFile(args[1])
+						if err != nil {
+							return err
+						}
+						privKey, err := os.ReadFile(args[2])
+						if err != nil {
+							return err
+						}
+						resp, result, err := app.client.UploadHttpsCertificate(app.ctx, args[0], string(pubCert), string(privKey))
+						return app.result(resp, result, err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func httpsCommand() *command {
+	return &command{
+		name:    "https",
+		summary: "Deploy HTTPS on endpoints",
+		sub: []*command{
+			{
+				name: "bind", summary: "Bind an uploaded certificate to an endpoint",
+				args: "<endpoint-id> <certificate-id>", minArgs: 2, maxArgs: 2,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					originProtocol := fs.String("origin-protocol", string(cdn.OriginProtocolHttp), "return-to-source protocol: Http, Https or FollowRequest")
+					autoRedirect := fs.Bool("auto-redirect", false, "redirect HTTP requests to HTTPS")
+					return func(app *app, args []string) error {
+						switch cdn.OriginProtocol(*originProtocol) {
+						case cdn.OriginProtocolHttp, cdn.OriginProtocolHttps, cdn.OriginProtocolFollowRequest:
+						default:
+							return usageErrorf("invalid --origin-protocol %q", *originProtocol)
+						}
+						resp, result, err := app.client.CreateHttpsBinding(app.ctx, &cdn.CreateHttpsBindingRequestBody{
+							EndpointID:        args[0],
+							CertificateID:     args[1],
+							OriginProtocol:    *originProtocol,
+							AutoHTTPSRedirect: *autoRedirect,
+						})
+						return app.result(resp, result, err)
+					}
+				},
+			},
+		},
+	}
+}
+
+func accessControlCommand() *command {
+	return &command{
+		name:    "access-control",
+		summary: "Manage forbidden IPs and referer control",
+		sub: []*command{
+			endpointCommand("get", "Get the access control configuration of an endpoint", func(app *app, endpointID string) error {
+				resp, result, err := app.client.GetAccessControlConfiguration(app.ctx, &cdn.GetAccessControlConfigurationRequest{EndpointID: endpointID})
+				return app.result(resp, result, err)
+			}),
+			{
+				name: "set", summary: "Replace the configuration from a file, or block and unblock IPs",
+				args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+				details: "--block and --unblock read the live configuration and write it back updated. With\n" +
+					"--dry-run the configuration is still read, which needs credentials and network access;\n" +
+					"only the update is printed instead of sent.",
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					file := fs.String("file", "", "JSON access control configuration replacing the current one, - for stdin")
+					block := stringsVar(fs, "block", "IP or CIDR to add to the forbidden IPs, repeatable")
+					unblock := stringsVar(fs, "unblock", "IP or CIDR to remove from the forbidden IPs, repeatable")
+					return func(app *app, args []string) error {
+						if *file != "" {
+							if len(*block) > 0 || len(*unblock) > 0 {
+								return usageErrorf("--file cannot be combined with --block or --unblock")
+							}
+							data, err := readFile(*file)
+							if err != nil {
+								return err
+							}
+							var body cdn.PutAccessControlConfigurationRequestBody
+							if err = json.Unmarshal(data, &body); err != nil {
+								return fmt.Errorf("parse %s: %w", *file, err)
+							}
+							if err = body.RefererControl.Validate(); err != nil {
+								return err
+							}
+							if _, err = cdn.ParseIPList(body.ForbiddenIps); err != nil {
+								return err
+							}
+							resp, result, err := app.client.PutAccessControlConfiguration(app.ctx, &cdn.PutAccessControlConfigurationRequest{EndpointID: args[0], Body: body})
+							return app.result(resp, result, err)
+						}
+						if len(*block) == 0 && len(*unblock) == 0 {
+							return usageErrorf("one of --file, --block or --unblock is required")
+						}
+						if _, err := cdn.ParseIPList(append(append([]string{}, *block...), *unblock...)); err != nil {
+							return usageError{err}
+						}
+						if len(*block) > 0 {
+							if err := app.result(app.client.AddForbiddenIPs(app.ctx, args[0], *block...)); err != nil {
+								return err
+							}
+						}
+						if len(*unblock) > 0 {
+							if err := app.result(app.client.RemoveForbiddenIPs(app.ctx, args[0], *unblock...)); err != nil {
+								return err
+							}
+						}
+						return nil
+					}
+				},
+			},
+		},
+	}
+}
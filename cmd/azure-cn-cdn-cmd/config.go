@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultProfileName = "default"
+
+// Config is the content of the configuration file:
+//
+//	default_profile: prod
+//	profiles:
+//	  prod:
+//	    key_id: ...
+//	    key_value: ...
+//	    subscription_id: ...
+type Config struct {
+	DefaultProfile string
+	Profiles       map[string]*Profile
+}
+
+// Profile holds the credentials of one subscription.
+type Profile struct {
+	KeyID          string
+	KeyValue       string
+	SubscriptionID string
+}
+
+var profileKeys = []string{"key_id", "key_value", "subscription_id"}
+
+func (p *Profile) field(key string) *string {
+	switch key {
+	case "key_id":
+		return &p.KeyID
+	case "key_value":
+		return &p.KeyValue
+	case "subscription_id":
+		return &p.SubscriptionID
+	}
+	return nil
+}
+
+// defaultConfigPath is ~/.config/azure-cn/config.yaml, or AZURE_CN_CONFIG
+// when set.
+func defaultConfigPath() string {
+	if path := os.Getenv("AZURE_CN_CONFIG"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "azure-cn", "config.yaml")
+}
+
+// loadConfig reads the configuration file. A missing file is an empty
+// configuration.
+func loadConfig(path string) (*Config, error) {
+	config := &Config{Profiles: map[string]*Profile{}}
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = config.parse(string(data)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// parse reads the YAML subset written by save: top level scalars, the
+// profiles mapping, and one mapping of scalars per profile.
+func (c *Config) parse(data string) error {
+	var profile *Profile
+	inProfiles := false
+	profileIndent := 0
+	for i, line := range strings.Split(data, "\n") {
+		lineNo := i + 1
+		content := strings.TrimRight(stripYAMLComment(line), " \t\r")
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		trimmed := strings.TrimLeft(content, " ")
+		indent := len(content) - len(trimmed)
+		if strings.HasPrefix(trimmed, "\t") {
+			return fmt.Errorf("line %d: tabs are not allowed for indentation", lineNo)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return fmt.Errorf("line %d: expected key: value", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value, err := parseYAMLScalar(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		switch {
+		case indent == 0:
+			profile, inProfiles = nil, false
+			switch key {
+			case "default_profile":
+				c.DefaultProfile = value
+			case "profiles":
+				if value != "" {
+					return fmt.Errorf("line %d: profiles must be a mapping", lineNo)
+				}
+				inProfiles = true
+			default:
+				return fmt.Errorf("line %d: unknown key %q", lineNo, key)
+			}
+		case inProfiles && (profile == nil || indent <= profileIndent):
+			if profile == nil {
+				profileIndent = indent
+			} else if indent != profileIndent {
+				return fmt.Errorf("line %d: unexpected indentation", lineNo)
+			}
+			if value != "" {
+				return fmt.Errorf("line %d: profile %q must be a mapping", lineNo, key)
+			}
+			profile = &Profile{}
+			c.Profiles[key] = profile
+		case profile != nil:
+			field := profile.field(key)
+			if field == nil {
+				return fmt.Errorf("line %d: unknown profile key %q", lineNo, key)
+			}
+			*field = value
+		default:
+			return fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+	}
+	return nil
+}
+
+func stripYAMLComment(line string) string {
+	quote := rune(0)
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseYAMLScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// save writes the configuration readable by the owner only, since it holds
+// keys.
+func (c *Config) save(path string) error {
+	var b strings.Builder
+	if c.DefaultProfile != "" {
+		fmt.Fprintf(&b, "default_profile: %s\n", yamlScalar(c.DefaultProfile))
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("profiles:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s:\n", yamlScalar(name))
+		for _, key := range profileKeys {
+			if value := *c.Profiles[name].field(key); value != "" {
+				fmt.Fprintf(&b, "    %s: %s\n", key, yamlScalar(value))
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// credentials are the values given by the --profile, --key-id, --key-value
+// and --subscription-id flags.
+type credentials struct {
+	configPath     string
+	profile        string
+	keyID          string
+	keyValue       string
+	subscriptionID string
+}
+
+// profileName is the profile selected by --profile, AZURE_CN_PROFILE or the
+// default_profile of the configuration, in that order.
+func (c *credentials) profileName(config *Config) (name string, explicit bool) {
+	if c.profile != "" {
+		return c.profile, true
+	}
+	if name = os.Getenv("AZURE_CN_PROFILE"); name != "" {
+		return name, true
+	}
+	if config.DefaultProfile != "" {
+		return config.DefaultProfile, true
+	}
+	return defaultProfileName, false
+}
+
+// resolve merges the credentials with flags first, then environment
+// variables, then the selected profile. The key ID and key value come as a
+// pair from the first of these setting either, so a key ID is never paired
+// with the key value of another key. When values are missing the partial
+// profile is returned along with errMissingCredentials.
+var errMissingCredentials = errors.New("missing")
+
+func (c *credentials) resolve() (*Profile, error) {
+	config, err := loadConfig(c.configPath)
+	if err != nil {
+		return nil, err
+	}
+	name, explicit := c.profileName(config)
+	profile := config.Profiles[name]
+	if profile == nil {
+		if explicit {
+			return nil, usageErrorf("profile %q not found in %s, run 'azure-cn-cdn-cmd configure --profile %s'", name, c.configPath, name)
+		}
+		profile = &Profile{}
+	}
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	resolved := &Profile{
+		SubscriptionID: first(c.subscriptionID, os.Getenv("AZURE_CN_SUBSCRIPTION_ID"), profile.SubscriptionID),
+	}
+	keySources := []struct {
+		name, keyID, keyValue string
+	}{
+		{"--key-id and --key-value", c.keyID, c.keyValue},
+		{"AZURE_CN_CDN_KEY_ID and AZURE_CN_CDN_KEY_VALUE", os.Getenv("AZURE_CN_CDN_KEY_ID"), os.Getenv("AZURE_CN_CDN_KEY_VALUE")},
+		{fmt.Sprintf("key_id and key_value of profile %q", name), profile.KeyID, profile.KeyValue},
+	}
+	for _, source := range keySources {
+		if source.keyID == "" && source.keyValue == "" {
+			continue
+		}
+		if source.keyID == "" || source.keyValue == "" {
+			return nil, usageErrorf("%s must be set together", source.name)
+		}
+		resolved.KeyID, resolved.KeyValue = source.keyID, source.keyValue
+		break
+	}
+	var missing []string
+	if resolved.KeyID == "" {
+		missing = append(missing, "key ID")
+	}
+	if resolved.KeyValue == "" {
+		missing = append(missing, "key value")
+	}
+	if resolved.SubscriptionID == "" {
+		missing = append(missing, "subscription ID")
+	}
+	if len(missing) > 0 {
+		return resolved, usageErrorf("%w %s: set them with flags, AZURE_CN_CDN_KEY_ID, AZURE_CN_CDN_KEY_VALUE and AZURE_CN_SUBSCRIPTION_ID, or run 'azure-cn-cdn-cmd configure'", errMissingCredentials, strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// prompt asks for a value on stdin, keeping current when the answer is empty.
+// Secret answers are read without echo when stty is available.
+func prompt(in *bufio.Reader, app *app, label, current string, secret bool) (string, error) {
+	shown := current
+	if secret && len(current) > 4 {
+		shown = "****" + current[len(current)-4:]
+	} else if secret && current != "" {
+		shown = "****"
+	}
+	fmt.Fprintf(app.stderr, "%s [%s]: ", label, shown)
+	if secret {
+		if restore := noEcho(); restore != nil {
+			defer func() {
+				restore()
+				fmt.Fprintln(app.stderr)
+			}()
+		}
+	}
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line, nil
+	}
+	return current, nil
+}
+
+// noEcho turns off terminal echo and returns the function restoring it, or
+// nil when stdin is not a terminal.
+func noEcho() (restore func()) {
+	stty := func(args ...string) error {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err != nil {
+		return nil
+	}
+	return func() { _ = stty("echo") }
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := &Config{
+		DefaultProfile: "prod",
+		Profiles: map[string]*Profile{
+			"prod":    {KeyID: "id-1", KeyValue: "value: with #hash", SubscriptionID: "0123-sub"},
+			"staging": {KeyID: "true", KeyValue: "'quoted'\"", SubscriptionID: "2023-01-01"},
+			"empty":   {},
+		},
+	}
+	if err := config.save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		t.Errorf("config mode = %v, want owner only", mode)
+	}
+	loaded, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("loaded %+v, want %+v", loaded, config)
+	}
+}
+
+func TestResolveKeyPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := &Config{Profiles: map[string]*Profile{
+		"default": {KeyID: "profile-id", KeyValue: "profile-value", SubscriptionID: "profile-sub"},
+	}}
+	if err := config.save(path); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		flags         credentials
+		envID, envKey string
+		want          Profile
+		wantErr       bool
+	}{
+		{name: "profile", want: Profile{"profile-id", "profile-value", "profile-sub"}},
+		{name: "env", envID: "env-id", envKey: "env-value", want: Profile{"env-id", "env-value", "profile-sub"}},
+		{name: "flags", flags: credentials{keyID: "flag-id", keyValue: "flag-value"}, envID: "env-id", envKey: "env-value",
+			want: Profile{"flag-id", "flag-value", "profile-sub"}},
+		{name: "env id only", envID: "env-id", wantErr: true},
+		{name: "flag value only", flags: credentials{keyValue: "flag-value"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AZURE_CN_PROFILE", "")
+			t.Setenv("AZURE_CN_SUBSCRIPTION_ID", "")
+			t.Setenv("AZURE_CN_CDN_KEY_ID", tt.envID)
+			t.Setenv("AZURE_CN_CDN_KEY_VALUE", tt.envKey)
+			c := tt.flags
+			c.configPath = path
+			got, err := c.resolve()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *got != tt.want {
+				t.Errorf("resolve() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
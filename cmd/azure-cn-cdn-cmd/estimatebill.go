@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn/billing"
+)
+
+func estimateBillCommand() *command {
+	return &command{
+		name: "estimate-bill", summary: "Estimate the bill of a month from a JSON price table",
+		args: "<price-table-path> [YYYY-MM]", minArgs: 1, maxArgs: 2,
+		setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+			return func(app *app, args []string) error {
+				var prices billing.PriceTable
+				data, err := readFile(args[0])
+				if err != nil {
+					return err
+				}
+				if err = json.Unmarshal(data, &prices); err != nil {
+					return fmt.Errorf("parse %s: %w", args[0], err)
+				}
+				month := time.Now().In(billing.ChinaStandardTime)
+				if len(args) > 1 {
+					if month, err = time.ParseInLocation("2006-01", args[1], billing.ChinaStandardTime); err != nil {
+						return usageErrorf("invalid month %q, expected YYYY-MM", args[1])
+					}
+				}
+				start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, billing.ChinaStandardTime)
+				estimator := &billing.Estimator{Client: app.client, Prices: prices}
+				estimate, err := estimator.Estimate(app.ctx, start, start.AddDate(0, 1, 0))
+				return app.result(nil, estimate, err)
+			}
+		},
+	}
+}
@@ -1,58 +1,195 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fdkevin0/azure-cn/cdn"
 )
 
 func main() {
-	cdnClient := cdn.NewClient(
-		os.Getenv("AZURE_CN_CDN_KEY_ID"),
-		os.Getenv("AZURE_CN_CDN_KEY_VALUE"),
-		os.Getenv("AZURE_CN_SUBSCRIPTION_ID"),
-	)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	if len(os.Args) == 1 {
-		log.Fatal("Please input command")
+func run(args []string, stdout, stderr io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	app := &app{ctx: ctx, stdout: stdout, stderr: stderr, output: outputFlag{spec: "json", print: printJSON}}
+	app.credentials.configPath = defaultConfigPath()
+	err := rootCommand().execute(app, []string{"azure-cn-cdn-cmd"}, args)
+	if err == nil {
+		return exitOK
 	}
-
-	switch os.Args[1] {
-	case "list-endpoints":
-		resp, result, err := cdnClient.ListEndpoints()
-		if err != nil {
-			log.Fatal(err)
+	fmt.Fprintln(stderr, "Error:", err)
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.correlationID != "" {
+		fmt.Fprintln(stderr, "X-Correlation-Id:", reqErr.correlationID)
+	}
+	if app.client != nil {
+		if skew, ok := app.client.ClockSkew(); ok && (skew > cdn.ClockSkewTolerance || skew < -cdn.ClockSkewTolerance) {
+			fmt.Fprintf(stderr, "Clock skew: the server clock is %s from the local clock\n", skew.Round(time.Second))
 		}
-		PrintJson(resp, result)
-	case "upload-https-certificate":
-		var (
-			pubCert []byte
-			privKey []byte
-			err     error
-			resp    *http.Response
-			result  *cdn.UploadHttpsCertificateResponse
-		)
-		if pubCert, err = os.ReadFile(os.Args[3]); err != nil {
-			log.Fatal(err)
+	}
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+	return exitError
+}
+
+type app struct {
+	ctx    context.Context // Canceled on interrupt
+	client *cdn.Client
+	stdout io.Writer
+	stderr io.Writer
+	output outputFlag
+
+	credentials credentials
+	dryRun      bool
+	debug       bool
+	globalFlags *flag.FlagSet // Shared by the flag sets of every command level
+}
+
+// requestError carries the correlation ID of a failed API call, which Azure
+// support asks for.
+type requestError struct {
+	err           error
+	correlationID string
+}
+
+func (e *requestError) Error() string { return e.err.Error() }
+
+func (e *requestError) Unwrap() error { return e.err }
+
+// result prints the result of an API call, or returns its error. Nothing is
+// printed for a request --dry-run did not send: its result is made up.
+func (a *app) result(resp *http.Response, result any, err error) error {
+	if err != nil {
+		reqErr := &requestError{err: err}
+		if resp != nil {
+			reqErr.correlationID = resp.Header.Get("X-Correlation-Id")
 		}
-		if privKey, err = os.ReadFile(os.Args[4]); err != nil {
-			log.Fatal(err)
+		return reqErr
+	}
+	if resp != nil && resp.Header.Get("X-Correlation-Id") == cdn.DryRunCorrelationID {
+		return nil
+	}
+	return a.print(result)
+}
+
+// print writes a result in the format selected by --output.
+func (a *app) print(v any) error {
+	return a.output.print(a.stdout, v)
+}
+
+// addGlobalFlags adds the flags accepted by every command to fs. The flags
+// of all levels share their values, so a global flag may be given before the
+// command name as well as after it.
+func (a *app) addGlobalFlags(fs *flag.FlagSet) {
+	if a.globalFlags == nil {
+		a.globalFlags = flag.NewFlagSet("global", flag.ContinueOnError)
+		a.registerGlobalFlags(a.globalFlags)
+	}
+	a.globalFlags.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+		fs.Lookup(f.Name).DefValue = f.DefValue
+	})
+}
+
+// registerGlobalFlags adds the flags accepted by every command.
+func (a *app) registerGlobalFlags(fs *flag.FlagSet) {
+	fs.Var(&a.output, "output", outputUsage)
+	fs.StringVar(&a.credentials.configPath, "config", a.credentials.configPath, "configuration file, AZURE_CN_CONFIG overrides the default")
+	fs.StringVar(&a.credentials.profile, "profile", "", "profile of the configuration file, AZURE_CN_PROFILE or default_profile by default")
+	fs.StringVar(&a.credentials.keyID, "key-id", "", "CDN key ID, overrides AZURE_CN_CDN_KEY_ID and the profile")
+	fs.StringVar(&a.credentials.keyValue, "key-value", "", "CDN key value, overrides AZURE_CN_CDN_KEY_VALUE and the profile")
+	fs.StringVar(&a.credentials.subscriptionID, "subscription-id", "", "subscription ID, overrides AZURE_CN_SUBSCRIPTION_ID and the profile")
+	fs.BoolVar(&a.dryRun, "dry-run", false, "print requests that would change anything to stderr instead of sending them")
+	fs.BoolVar(&a.debug, "debug", false, "log requests and responses to stderr, with secrets redacted")
+}
+
+// isGlobalFlag reports whether name was added by registerGlobalFlags.
+func isGlobalFlag(name string) bool {
+	switch name {
+	case "output", "config", "profile", "key-id", "key-value", "subscription-id", "dry-run", "debug":
+		return true
+	}
+	return false
+}
+
+// connect resolves the credentials and creates the client. It runs after
+// flags are parsed, before any command talking to the API.
+//
+// With --dry-run, missing credentials are replaced by placeholders so the
+// requests that would be sent can be printed offline; requests reading the
+// live state then fail without reaching the network.
+func (a *app) connect() error {
+	profile, err := a.credentials.resolve()
+	offline := a.dryRun && errors.Is(err, errMissingCredentials)
+	if err != nil && !offline {
+		return err
+	}
+	if offline {
+		placeholder := func(value, name string) string {
+			if value == "" {
+				return name
+			}
+			return value
 		}
-		if resp, result, err = cdnClient.UploadHttpsCertificate(os.Args[2], string(pubCert), string(privKey)); err != nil {
-			log.Println("X-Correlation-Id:", resp.Header.Get("X-Correlation-Id"))
-			log.Fatalln(err)
+		profile.KeyID = placeholder(profile.KeyID, "KEY_ID")
+		profile.KeyValue = placeholder(profile.KeyValue, "KEY_VALUE")
+		profile.SubscriptionID = placeholder(profile.SubscriptionID, "SUBSCRIPTION_ID")
+	}
+	a.client = cdn.NewClient(profile.KeyID, profile.KeyValue, profile.SubscriptionID, cdn.WithUserAgent("azure-cn-cdn-cmd"))
+	if a.dryRun {
+		a.client.DryRun = a.stderr
+	}
+	if offline {
+		a.client.HTTPClient = &http.Client{Transport: offlineTransport{}}
+	}
+	if a.debug {
+		a.client.Logger = debugLogger{a.stderr}
+	}
+	if dir := os.Getenv("AZURE_CN_CDN_TRAFFIC_CACHE"); dir != "" {
+		trafficCache, err := cdn.NewFileTrafficCache(dir)
+		if err != nil {
+			return err
 		}
-		PrintJson(result)
+		a.client.TrafficCache = trafficCache
 	}
+	return nil
+}
+
+// offlineTransport fails every request, for --dry-run without credentials.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("--dry-run without credentials cannot read the live state, set the credentials")
 }
 
-func PrintJson(a ...any) {
-	for _, v := range a {
-		b, _ := json.MarshalIndent(v, "", "  ")
-		fmt.Println(string(b))
+// debugLogger writes the client logs as "key=value" lines.
+type debugLogger struct {
+	w io.Writer
+}
+
+func (l debugLogger) Debug(msg string, args ...any) {
+	var b strings.Builder
+	b.WriteString(time.Now().Format("15:04:05.000") + " DEBUG " + msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		value := fmt.Sprint(args[i+1])
+		if value == "" || strings.ContainsAny(value, " \"=\n") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %v=%s", args[i], value)
 	}
+	fmt.Fprintln(l.w, b.String())
 }
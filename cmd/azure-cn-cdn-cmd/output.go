@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+const outputUsage = "output format: json, yaml, table, csv, template=<go-template> or jsonpath=<expression>"
+
+// outputFlag is the value of --output. Set validates the format and compiles
+// templates and expressions, so a bad value is reported as a usage error
+// before any request is sent.
+type outputFlag struct {
+	spec  string
+	set   bool // Given on the command line
+	print func(w io.Writer, v any) error
+}
+
+// name returns the format without its argument.
+func (o *outputFlag) name() string {
+	name, _, _ := strings.Cut(o.spec, "=")
+	return name
+}
+
+func (o *outputFlag) String() string { return o.spec }
+
+func (o *outputFlag) Set(spec string) error {
+	name, arg, _ := strings.Cut(spec, "=")
+	switch name {
+	case "json":
+		o.print = printJSON
+	case "yaml":
+		o.print = printYAML
+	case "table":
+		o.print = printTable
+	case "csv":
+		o.print = printCSV
+	case "template", "go-template":
+		t, err := template.New("output").Option("missingkey=zero").Parse(arg)
+		if err != nil {
+			return err
+		}
+		o.print = func(w io.Writer, v any) error {
+			data, err := normalize(v)
+			if err != nil {
+				return err
+			}
+			return t.Execute(w, data)
+		}
+	case "jsonpath":
+		path, err := parseJSONPath(arg)
+		if err != nil {
+			return err
+		}
+		o.print = func(w io.Writer, v any) error { return printJSONPath(w, v, path) }
+	default:
+		return fmt.Errorf("unknown output format %q, expected json, yaml, table, csv, template=... or jsonpath=...", spec)
+	}
+	o.spec, o.set = spec, true
+	return nil
+}
+
+// marshalRedacted encodes v with secrets redacted, as in every output.
+func marshalRedacted(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return cdn.RedactJSON(b), nil
+}
+
+func printJSON(w io.Writer, v any) error {
+	b, err := marshalRedacted(v)
+	if err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, b, "", "  "); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, indented.String())
+	return err
+}
+
+// normalize converts v to the generic form of its JSON encoding, so templates
+// and expressions address fields by the names shown in the json output.
+// Secrets are redacted, as in every output.
+func normalize(v any) (any, error) {
+	b, err := marshalRedacted(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var data any
+	err = d.Decode(&data)
+	return data, err
+}
+
+// object is a decoded JSON object keeping the field order of the encoding.
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+// normalizeOrdered is normalize with objects decoded as object instead of
+// maps, for outputs where the declaration order of struct fields matters.
+func normalizeOrdered(v any) (any, error) {
+	b, err := marshalRedacted(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return decodeOrdered(d)
+}
+
+func decodeOrdered(d *json.Decoder) (any, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		obj := object{}
+		for d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, field{key.(string), value})
+		}
+		_, err = d.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []any{}
+		for d.More() {
+			value, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = d.Token()
+		return list, err
+	}
+	return t, nil
+}
+
+func printYAML(w io.Writer, v any) error {
+	data, err := normalizeOrdered(v)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	writeYAML(&b, data, 0)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func writeYAML(b *strings.Builder, v any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch v := v.(type) {
+	case object:
+		if len(v) == 0 {
+			b.WriteString(pad + "{}\n")
+			return
+		}
+		for _, f := range v {
+			b.WriteString(pad + yamlScalar(f.key) + ":")
+			if isYAMLBlock(f.value) {
+				b.WriteString("\n")
+				writeYAML(b, f.value, indent+2)
+			} else {
+				b.WriteString(" " + yamlScalar(f.value) + "\n")
+			}
+		}
+	case []any:
+		if len(v) == 0 {
+			b.WriteString(pad + "[]\n")
+			return
+		}
+		for _, item := range v {
+			if !isYAMLBlock(item) {
+				b.WriteString(pad + "- " + yamlScalar(item) + "\n")
+				continue
+			}
+			// The first line of a nested block goes on the dash line.
+			var nested strings.Builder
+			writeYAML(&nested, item, indent+2)
+			b.WriteString(pad + "- " + nested.String()[indent+2:])
+		}
+	default:
+		b.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+func isYAMLBlock(v any) bool {
+	switch v := v.(type) {
+	case object:
+		return len(v) > 0
+	case []any:
+		return len(v) > 0
+	}
+	return false
+}
+
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if yamlNeedsQuotes(v) {
+			return strconv.Quote(v)
+		}
+		return v
+	case object:
+		return "{}"
+	case []any:
+		return "[]"
+	}
+	return fmt.Sprint(v)
+}
+
+// yamlNeedsQuotes reports whether s would not read back as the same string
+// when written plain. Strings starting with a digit, "+" or "." are always
+// quoted, since YAML parsers read many of them as numbers or timestamps,
+// e.g. 0x1F, 1_000, 1:30, .inf or 2023-01-01T00:00:00Z.
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n", "<<", "=":
+		return true
+	}
+	if strings.ContainsAny(s[:1], "0123456789+.-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// table is the tabular view of a result, used by the table and csv outputs.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func printTable(w io.Writer, v any) error {
+	t, err := tableOf(v)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func printCSV(w io.Writer, v any) error {
+	t, err := tableOf(v)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err = cw.Write(t.header); err != nil {
+		return err
+	}
+	if err = cw.WriteAll(t.rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// tableOf returns the columns worth reading at a glance for the results
+// listed here, and a generic view of the JSON encoding of other results.
+func tableOf(v any) (*table, error) {
+	switch v := v.(type) {
+	case *cdn.ListEndpointsResponse:
+		t := endpointTable()
+		for _, endpoint := range *v {
+			t.rows = append(t.rows, endpointRow(endpoint))
+		}
+		return t, nil
+	case *cdn.GetEndpointResponse:
+		t := endpointTable()
+		t.rows = append(t.rows, endpointRow(cdn.Endpoint(*v)))
+		return t, nil
+	case *cdn.CreateEndpointResponse:
+		t := endpointTable()
+		t.rows = append(t.rows, endpointRow(cdn.Endpoint(*v)))
+		return t, nil
+	case *cdn.GetCachePolicyResponse:
+		t := &table{header: []string{"TYPE", "ITEMS", "TTL"}}
+		for _, rule := range v.Rules {
+			t.rows = append(t.rows, []string{string(rule.Type), strings.Join(rule.Items, ";"), strconv.FormatInt(rule.TTL, 10)})
+		}
+		return t, nil
+	case *cdn.BandwidthSeries:
+		t := &table{header: []string{"TIME", "BANDWIDTH_MBPS", "ORIGIN_BANDWIDTH_MBPS"}}
+		for _, p := range v.Items {
+			t.rows = append(t.rows, []string{formatTime(p.Time), strconv.FormatInt(p.BandwidthInMbps, 10), strconv.FormatInt(p.OriginBandwidthInMbps, 10)})
+		}
+		return t, nil
+	case *cdn.VolumeSeries:
+		t := &table{header: []string{"TIME", "VOLUME_MB", "ORIGIN_VOLUME_MB"}}
+		for _, p := range v.Items {
+			t.rows = append(t.rows, []string{formatTime(p.Time), strconv.FormatInt(p.VolumeInMB, 10), strconv.FormatInt(p.OriginVolumeInMB, 10)})
+		}
+		return t, nil
+	case *cdn.SubscriptionRollup:
+		t := &table{header: []string{"ENDPOINT_ID", "DOMAIN", "SERVICE_TYPE", "CDN_VOLUME_MB", "ORIGIN_VOLUME_MB", "PEAK_MBPS", "VOLUME_PERCENT"}}
+		for _, d := range v.TopDomains {
+			t.rows = append(t.rows, []string{
+				d.EndpointID,
+				d.DomainName,
+				d.ServiceType,
+				strconv.FormatInt(d.TotalCDNVolumeInMB, 10),
+				strconv.FormatInt(d.TotalOriginVolumeInMB, 10),
+				strconv.FormatInt(d.PeakBandwidthInMbps, 10),
+				strconv.FormatFloat(d.VolumePercent, 'f', 2, 64),
+			})
+		}
+		return t, nil
+	}
+	data, err := normalizeOrdered(v)
+	if err != nil {
+		return nil, err
+	}
+	return genericTable(data), nil
+}
+
+func endpointTable() *table {
+	return &table{header: []string{"ENDPOINT_ID", "DOMAIN", "SERVICE_TYPE", "ENABLED", "ICP_STATUS", "LIFETIME_STATUS", "CNAME_CONFIGURED", "ORIGINS"}}
+}
+
+func endpointRow(e cdn.Endpoint) []string {
+	return []string{
+		e.EndpointID,
+		e.Settings.CustomDomain,
+		e.Settings.ServiceType,
+		strconv.FormatBool(e.Status.Enabled),
+		e.Status.ICPVerifyStatus,
+		e.Status.LifetimeStatus,
+		strconv.FormatBool(e.Status.CNameConfigured),
+		strings.Join(e.Settings.Origin.Addresses, ";"),
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// genericTable lays out a list of objects as one row per object, an object
+// as one row per leaf field and anything else as a single value.
+func genericTable(data any) *table {
+	switch data := data.(type) {
+	case []any:
+		t := &table{}
+		columns := map[string]int{}
+		var rows []map[string]string
+		for _, item := range data {
+			row := map[string]string{}
+			obj, ok := item.(object)
+			if !ok {
+				obj = object{{"VALUE", item}}
+			}
+			for _, f := range obj {
+				if _, ok := columns[f.key]; !ok {
+					columns[f.key] = len(t.header)
+					t.header = append(t.header, f.key)
+				}
+				row[f.key] = cellString(f.value)
+			}
+			rows = append(rows, row)
+		}
+		for _, row := range rows {
+			cells := make([]string, len(t.header))
+			for i, key := range t.header {
+				cells[i] = row[key]
+			}
+			t.rows = append(t.rows, cells)
+		}
+		return t
+	case object:
+		t := &table{header: []string{"FIELD", "VALUE"}}
+		var flatten func(prefix string, v any)
+		flatten = func(prefix string, v any) {
+			if obj, ok := v.(object); ok && len(obj) > 0 {
+				for _, f := range obj {
+					key := f.key
+					if prefix != "" {
+						key = prefix + "." + key
+					}
+					flatten(key, f.value)
+				}
+				return
+			}
+			t.rows = append(t.rows, []string{prefix, cellString(v)})
+		}
+		flatten("", data)
+		return t
+	}
+	return &table{header: []string{"VALUE"}, rows: [][]string{{cellString(data)}}}
+}
+
+// cellString formats a decoded JSON value for a single table cell: lists of
+// scalars are joined with ";", other containers are compact JSON.
+func cellString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if isYAMLBlock(item) {
+				return compactJSON(v)
+			}
+			parts = append(parts, cellString(item))
+		}
+		return strings.Join(parts, ";")
+	}
+	return compactJSON(v)
+}
+
+func compactJSON(v any) string {
+	var b strings.Builder
+	writeCompactJSON(&b, v)
+	return b.String()
+}
+
+func writeCompactJSON(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case object:
+		b.WriteString("{")
+		for i, f := range v {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			key, _ := json.Marshal(f.key)
+			b.Write(key)
+			b.WriteString(":")
+			writeCompactJSON(b, f.value)
+		}
+		b.WriteString("}")
+	case []any:
+		b.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			writeCompactJSON(b, item)
+		}
+		b.WriteString("]")
+	default:
+		data, _ := json.Marshal(v)
+		b.Write(data)
+	}
+}
+
+// jsonPathStep selects children of a value: a field name, a list index, or
+// every element when wildcard is set.
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the subset of JSONPath made of field names, indexes
+// and wildcards, e.g. {.Items[*].Time}. The braces and the leading $ are
+// optional.
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	s = strings.TrimPrefix(s, "$")
+	var steps []jsonPathStep
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			switch name {
+			case "":
+				if s != "" {
+					return nil, fmt.Errorf("invalid jsonpath %q: empty field name", expr)
+				}
+			case "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			default:
+				steps = append(steps, jsonPathStep{name: name})
+			}
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jsonpath %q: missing ]", expr)
+			}
+			sub := s[1:end]
+			s = s[end+1:]
+			if sub == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+				continue
+			}
+			if unquoted := strings.Trim(sub, "'\""); unquoted != sub {
+				steps = append(steps, jsonPathStep{name: unquoted})
+				continue
+			}
+			index, err := strconv.Atoi(sub)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonpath %q: bad index %q", expr, sub)
+			}
+			steps = append(steps, jsonPathStep{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("invalid jsonpath %q: unexpected %q", expr, s[:1])
+		}
+	}
+	return steps, nil
+}
+
+func evalJSONPath(data any, steps []jsonPathStep) []any {
+	values := []any{data}
+	for _, step := range steps {
+		var next []any
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]any:
+				if step.wildcard {
+					for _, key := range sortedKeys(v) {
+						next = append(next, v[key])
+					}
+				} else if child, ok := v[step.name]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				switch {
+				case step.wildcard:
+					next = append(next, v...)
+				case step.isIndex:
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printJSONPath prints each selected value on its own line: strings and
+// numbers as is, objects and lists as compact JSON.
+func printJSONPath(w io.Writer, v any, steps []jsonPathStep) error {
+	data, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	for _, value := range evalJSONPath(data, steps) {
+		var s string
+		switch value := value.(type) {
+		case map[string]any, []any:
+			b, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			s = string(b)
+		default:
+			s = cellString(value)
+		}
+		if _, err = fmt.Fprintln(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
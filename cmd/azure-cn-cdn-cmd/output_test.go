@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+	"github.com/fdkevin0/azure-cn/cdn/export"
+)
+
+func TestYAMLNeedsQuotes(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"cdn.example.cn", false},
+		{"ep-123", false},
+		{"Web", false},
+		{"", true},
+		{" padded", true},
+		{"true", true},
+		{"No", true},
+		{"null", true},
+		{"~", true},
+		{"42", true},
+		{"1.5", true},
+		{"0x1F", true},
+		{"1_000", true},
+		{"1:30", true},
+		{".inf", true},
+		{"+1", true},
+		{"2023-01-01", true},
+		{"2023-01-01T00:00:00Z", true},
+		{"-dash", true},
+		{"key: value", true},
+		{"a #comment", true},
+		{"trailing:", true},
+		{"line\nbreak", true},
+	}
+	for _, tt := range tests {
+		if got := yamlNeedsQuotes(tt.s); got != tt.want {
+			t.Errorf("yamlNeedsQuotes(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestPrintYAML(t *testing.T) {
+	series := &cdn.VolumeSeries{
+		EndpointID:  "ep1",
+		DomainName:  "cdn.example.cn",
+		Granularity: cdn.GranularityPerHour,
+		StartTime:   time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:     time.Date(2023, 1, 1, 2, 0, 0, 0, time.UTC),
+		Items: []cdn.VolumePoint{
+			{Time: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), VolumeInMB: 2, OriginVolumeInMB: 1},
+		},
+		TotalCDNVolumeInMB:    2,
+		TotalOriginVolumeInMB: 1,
+	}
+	var out strings.Builder
+	if err := printYAML(&out, series); err != nil {
+		t.Fatal(err)
+	}
+	want := `EndpointID: ep1
+DomainName: cdn.example.cn
+Granularity: PerHour
+StartTime: "2023-01-01T00:00:00Z"
+EndTime: "2023-01-01T02:00:00Z"
+Items:
+  - Time: "2023-01-01T00:00:00Z"
+    VolumeInMB: 2
+    OriginVolumeInMB: 1
+TotalCDNVolumeInMB: 2
+TotalOriginVolumeInMB: 1
+`
+	if out.String() != want {
+		t.Errorf("yaml =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestPrintYAMLEmptyAndNested(t *testing.T) {
+	var out strings.Builder
+	v := map[string]any{"a": []any{}, "b": map[string]any{}, "c": []any{[]any{1, "x"}}, "d": nil}
+	if err := printYAML(&out, v); err != nil {
+		t.Fatal(err)
+	}
+	want := "a: []\nb: {}\nc:\n  - - 1\n    - x\nd: null\n"
+	if out.String() != want {
+		t.Errorf("yaml =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	v := map[string]any{
+		"Items": []any{
+			map[string]any{"Time": "t1", "Tags": []any{"a", "b"}},
+			map[string]any{"Time": "t2", "Tags": []any{}},
+		},
+		"Name": "n",
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"{.Name}", "n\n"},
+		{"$.Name", "n\n"},
+		{".Items[*].Time", "t1\nt2\n"},
+		{"{.Items[-1].Time}", "t2\n"},
+		{"{.Items[0].Tags}", "[\"a\",\"b\"]\n"},
+		{"{.Items[0]['Time']}", "t1\n"},
+		{"{.Items[5].Time}", ""},
+		{"{.Missing}", ""},
+	}
+	for _, tt := range tests {
+		steps, err := parseJSONPath(tt.expr)
+		if err != nil {
+			t.Errorf("parseJSONPath(%q): %v", tt.expr, err)
+			continue
+		}
+		var out strings.Builder
+		if err = printJSONPath(&out, v, steps); err != nil {
+			t.Errorf("printJSONPath(%q): %v", tt.expr, err)
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("jsonpath %q = %q, want %q", tt.expr, out.String(), tt.want)
+		}
+	}
+	for _, expr := range []string{"{.Items[}", "{.Items[x]}", "{Items}", "{.Items..Time}"} {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("parseJSONPath(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	output := func(spec string) *outputFlag {
+		o := &outputFlag{spec: "json", print: printJSON}
+		if spec != "" {
+			if err := o.Set(spec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return o
+	}
+	tests := []struct {
+		format, output string
+		want           export.Format
+		wantErr        bool
+	}{
+		{"", "", export.FormatCSV, false},
+		{"jsonl", "", export.FormatJSONLines, false},
+		{"", "json", export.FormatJSONLines, false},
+		{"", "csv", export.FormatCSV, false},
+		{"csv", "csv", export.FormatCSV, false},
+		{"csv", "json", "", true},
+		{"", "yaml", "", true},
+		{"xml", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := exportFormat(tt.format, output(tt.output))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("exportFormat(%q, --output %q) = %q, %v, want %q, error %v", tt.format, tt.output, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
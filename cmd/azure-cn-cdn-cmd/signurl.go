@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn/urlsign"
+)
+
+func signURLCommand() *command {
+	return &command{
+		name: "sign-url", summary: "Sign a URL for CDN URL authentication, the key is read from AZURE_CN_CDN_URL_SIGN_KEY",
+		args: "<url>", minArgs: 1, maxArgs: 1, local: true,
+		setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+			signType := fs.String("type", "A", "URL authentication type: A, B or C")
+			ttl := fs.Duration("ttl", 0, "validity period used to print the expiry time")
+			return func(app *app, args []string) error {
+				signer := &urlsign.Signer{
+					Type: urlsign.Type(strings.ToUpper(*signType)),
+					Key:  os.Getenv("AZURE_CN_CDN_URL_SIGN_KEY"),
+					TTL:  *ttl,
+				}
+				switch signer.Type {
+				case urlsign.TypeA, urlsign.TypeB, urlsign.TypeC:
+				default:
+					return usageErrorf("invalid --type %q", *signType)
+				}
+				if signer.Key == "" {
+					return usageErrorf("AZURE_CN_CDN_URL_SIGN_KEY is not set")
+				}
+				now := time.Now()
+				signed, err := signer.Sign(args[0], now)
+				if err != nil {
+					return err
+				}
+				result := struct {
+					URL       string
+					ExpiresAt *time.Time `json:",omitempty"`
+				}{URL: signed}
+				if *ttl > 0 {
+					expiresAt := now.Add(*ttl)
+					result.ExpiresAt = &expiresAt
+				}
+				return app.print(result)
+			}
+		},
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+// rawTerminal is not supported on this platform: keys must be followed by
+// Enter.
+func rawTerminal() (restore func(), ok bool) {
+	return func() {}, false
+}
@@ -0,0 +1,49 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd uintptr) (syscall.Termios, error) {
+	var t syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return t, errno
+	}
+	return t, nil
+}
+
+func setTermios(fd uintptr, t syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// rawTerminal switches the terminal on stdin to unbuffered input without
+// echo so single key presses are read immediately. Reads return after a
+// tenth of a second without input, so a reader can notice it should stop.
+// ok is false when stdin is not a terminal.
+func rawTerminal() (restore func(), ok bool) {
+	fd := os.Stdin.Fd()
+	saved, err := getTermios(fd)
+	if err != nil {
+		return func() {}, false
+	}
+	raw := saved
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 1
+	if err = setTermios(fd, raw); err != nil {
+		return func() {}, false
+	}
+	fmt.Print("\033[?25l")
+	return func() {
+		fmt.Print("\033[?25h\r\n")
+		_ = setTermios(fd, saved)
+	}, true
+}
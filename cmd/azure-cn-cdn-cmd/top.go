@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+type topRow struct {
+	endpoint  cdn.Endpoint
+	bandwidth []int64
+	origin    []int64
+	err       error
+}
+
+func (r topRow) current(series []int64) int64 {
+	if len(series) == 0 {
+		return 0
+	}
+	return series[len(series)-1]
+}
+
+// Sort column
+type topSort byte
+
+const (
+	topSortDomain    topSort = 'd'
+	topSortBandwidth topSort = 'b'
+	topSortOrigin    topSort = 'o'
+	topSortStatus    topSort = 's'
+)
+
+func topCommand() *command {
+	return &command{
+		name: "top", summary: "Show live bandwidth and status of all endpoints",
+		setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+			interval := fs.Duration("interval", time.Minute, "refresh interval")
+			window := fs.Duration("window", time.Hour, "bandwidth history shown in the sparkline")
+			sortBy := fs.String("sort", "b", "initial sort column: d, b, o or s")
+			return func(app *app, args []string) error {
+				if *interval <= 0 || *window <= 0 {
+					return usageErrorf("--interval and --window must be positive")
+				}
+				column := topSort(0)
+				if len(*sortBy) == 1 {
+					column = topSort((*sortBy)[0])
+				}
+				switch column {
+				case topSortDomain, topSortBandwidth, topSortOrigin, topSortStatus:
+				default:
+					return usageErrorf("invalid --sort %q, want d, b, o or s", *sortBy)
+				}
+				if app.output.set {
+					return usageErrorf("top is interactive and does not support --output")
+				}
+				runTop(app.ctx, app.client, *interval, *window, column)
+				return nil
+			}
+		},
+	}
+}
+
+// runTop shows a live, refreshing table of all endpoints until "q" or ctx is
+// canceled. Keys: d/b/o/s sort by domain, bandwidth, origin bandwidth or
+// status, r reverses the order, space refreshes immediately.
+func runTop(ctx context.Context, client *cdn.Client, interval, window time.Duration, column topSort) {
+	restore, raw := rawTerminal()
+	defer restore()
+
+	// In raw mode reads time out regularly, so the reader stops before the
+	// terminal is restored. Otherwise a pending read cannot be interrupted
+	// and the reader ends with the next line or the end of stdin.
+	keys := make(chan byte)
+	done := make(chan struct{})
+	var reader sync.WaitGroup
+	reader.Add(1)
+	go func() {
+		defer reader.Done()
+		defer close(keys)
+		buf := make([]byte, 1)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n == 1 {
+				select {
+				case keys <- buf[0]:
+				case <-done:
+					return
+				}
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// A raw mode read timing out is reported as io.EOF.
+			if err != nil && !(raw && err == io.EOF) {
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		if raw {
+			reader.Wait()
+		}
+	}()
+
+	var (
+		rows      []topRow
+		fetchErr  error
+		updated   time.Time
+		reverse   bool
+		refreshed = make(chan struct{}, 1)
+		mu        sync.Mutex
+	)
+	refresh := func() {
+		r, err := fetchTopRows(ctx, client, window)
+		mu.Lock()
+		rows, fetchErr, updated = r, err, time.Now()
+		mu.Unlock()
+		select {
+		case refreshed <- struct{}{}:
+		default:
+		}
+	}
+	go refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		mu.Lock()
+		drawTop(os.Stdout, rows, fetchErr, updated, column, reverse)
+		mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			go refresh()
+		case <-refreshed:
+		case key, ok := <-keys:
+			if !ok {
+				keys = nil
+				continue
+			}
+			switch key {
+			case 'q', 'Q':
+				return
+			case 'r':
+				reverse = !reverse
+			case ' ':
+				go refresh()
+			case byte(topSortDomain), byte(topSortBandwidth), byte(topSortOrigin), byte(topSortStatus):
+				column = topSort(key)
+			}
+		}
+	}
+}
+
+func fetchTopRows(ctx context.Context, client *cdn.Client, window time.Duration) ([]topRow, error) {
+	_, endpoints, err := client.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if endpoints == nil {
+		return nil, nil
+	}
+	rows := make([]topRow, len(*endpoints))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 4)
+	now := time.Now()
+	for i, endpoint := range *endpoints {
+		rows[i].endpoint = endpoint
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(row *topRow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_, result, err := client.GetEndpointBandwidth(ctx, &cdn.GetEndpointBandwidthRequest{
+				EndpointId: row.endpoint.EndpointID,
+				StartTime:  now.Add(-window),
+				EndTime:    now,
+			})
+			if err != nil {
+				row.err = err
+				return
+			}
+			if result == nil {
+				return
+			}
+			for _, item := range result.Items {
+				row.bandwidth = append(row.bandwidth, item.BandwidthInMbps)
+				row.origin = append(row.origin, item.OriginBandwidthInMbps)
+			}
+		}(&rows[i])
+	}
+	wg.Wait()
+	return rows, nil
+}
+
+func drawTop(w io.Writer, rows []topRow, fetchErr error, updated time.Time, column topSort, reverse bool) {
+	sorted := append([]topRow(nil), rows...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if reverse {
+			a, b = b, a
+		}
+		switch column {
+		case topSortDomain:
+			return a.endpoint.Settings.CustomDomain < b.endpoint.Settings.CustomDomain
+		case topSortOrigin:
+			return a.current(a.origin) > b.current(b.origin)
+		case topSortStatus:
+			return topStatus(a.endpoint) < topStatus(b.endpoint)
+		default:
+			return a.current(a.bandwidth) > b.current(b.bandwidth)
+		}
+	})
+
+	fmt.Fprint(w, "\033[H\033[2J")
+	status := "loading..."
+	if !updated.IsZero() {
+		status = "updated " + updated.Format("15:04:05")
+	}
+	order := ""
+	if reverse {
+		order = " (reversed)"
+	}
+	fmt.Fprintf(w, "azure-cn-cdn top - %d endpoints - %s - sort: %c%s\r\n", len(rows), status, column, order)
+	fmt.Fprint(w, "keys: d domain, b bandwidth, o origin, s status, r reverse, space refresh, q quit\r\n\r\n")
+	if fetchErr != nil {
+		fmt.Fprintf(w, "error: %v\r\n", fetchErr)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "DOMAIN\tTYPE\tMBPS\tORIGIN MBPS\tSTATUS\tBANDWIDTH\r\n")
+	for _, row := range sorted {
+		spark := sparkline(row.bandwidth, 30)
+		if row.err != nil {
+			spark = "error: " + row.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\r\n",
+			row.endpoint.Settings.CustomDomain, row.endpoint.Settings.ServiceType,
+			row.current(row.bandwidth), row.current(row.origin), topStatus(row.endpoint), spark)
+	}
+	tw.Flush()
+}
+
+func topStatus(e cdn.Endpoint) string {
+	var flags []string
+	if e.Status.Enabled {
+		flags = append(flags, "enabled")
+	} else {
+		flags = append(flags, "disabled")
+	}
+	if !e.Status.CNameConfigured {
+		flags = append(flags, "no-cname")
+	}
+	if e.Status.ICPVerifyStatus != "" {
+		flags = append(flags, "icp:"+e.Status.ICPVerifyStatus)
+	}
+	return strings.Join(flags, ",")
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the last width values scaled to the highest of them.
+// Values below zero are drawn as the lowest block.
+func sparkline(values []int64, width int) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	var max int64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var sb strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > 0 && v > 0 {
+			i = int(v * int64(len(sparkBlocks)-1) / max)
+		}
+		sb.WriteRune(sparkBlocks[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []int64
+		width  int
+		want   string
+	}{
+		{nil, 5, ""},
+		{[]int64{0, 0}, 5, "▁▁"},
+		{[]int64{0, 7, 14}, 5, "▁▄█"},
+		{[]int64{-5, 7}, 5, "▁█"},
+		{[]int64{-5, -1}, 5, "▁▁"},
+		{[]int64{1, 2, 3, 4}, 2, "▆█"},
+	}
+	for _, tt := range tests {
+		if got := sparkline(tt.values, tt.width); got != tt.want {
+			t.Errorf("sparkline(%v, %d) = %q, want %q", tt.values, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestFetchTopRowsEmptyResponses(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/endpoints") {
+			w.Write([]byte(`[{"EndpointID":"ep1"}]`))
+			return
+		}
+		w.Write([]byte(`null`))
+	}))
+	defer srv.Close()
+	client := cdn.NewClient("id", "key", "sub")
+	client.HTTPClient = srv.Client()
+	client.RestAPIEndpoint = srv.Listener.Addr().String()
+	rows, err := fetchTopRows(context.Background(), client, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].err != nil || len(rows[0].bandwidth) != 0 {
+		t.Errorf("rows = %+v", rows)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+	"github.com/fdkevin0/azure-cn/cdn/export"
+)
+
+func trafficCommand() *command {
+	return &command{
+		name:    "traffic",
+		summary: "Query bandwidth and volume statistics",
+		sub: []*command{
+			{
+				name: "bandwidth", summary: "Get the bandwidth of an endpoint, per five minutes",
+				args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					timeRange := timeRangeFlags(fs, time.Hour)
+					return func(app *app, args []string) error {
+						start, end, err := timeRange()
+						if err != nil {
+							return err
+						}
+						series, err := app.client.QueryBandwidth(app.ctx, &cdn.GetEndpointBandwidthRequest{EndpointId: args[0], StartTime: start, EndTime: end})
+						return app.result(nil, series, err)
+					}
+				},
+			},
+			{
+				name: "volume", summary: "Get the traffic volume of an endpoint",
+				args: "<endpoint-id>", minArgs: 1, maxArgs: 1,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					timeRange := timeRangeFlags(fs, 24*time.Hour)
+					granularity := granularityFlag(fs)
+					return func(app *app, args []string) error {
+						start, end, err := timeRange()
+						if err != nil {
+							return err
+						}
+						if err = granularity().Validate(); err != nil {
+							return usageError{err}
+						}
+						series, err := app.client.QueryVolume(app.ctx, &cdn.GetEndpointVolumeRequest{
+							EndpointID:  args[0],
+							Granularity: granularity(),
+							StartTime:   start,
+							EndTime:     end,
+						})
+						return app.result(nil, series, err)
+					}
+				},
+			},
+			{
+				name: "rollup", summary: "Sum the traffic of all endpoints and rank domains by volume",
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					timeRange := timeRangeFlags(fs, 24*time.Hour)
+					granularity := granularityFlag(fs)
+					top := fs.Int("top", 10, "number of top domains")
+					return func(app *app, args []string) error {
+						start, end, err := timeRange()
+						if err != nil {
+							return err
+						}
+						if err = granularity().Validate(); err != nil {
+							return usageError{err}
+						}
+						rollup, err := app.client.QuerySubscriptionRollup(app.ctx, &cdn.SubscriptionRollupRequest{
+							StartTime:   start,
+							EndTime:     end,
+							Granularity: granularity(),
+							TopN:        *top,
+						})
+						return app.result(nil, rollup, err)
+					}
+				},
+			},
+			{
+				name: "export", summary: "Export bandwidth and volume series as CSV or JSON Lines",
+				args: "[endpoint-id...]", maxArgs: -1,
+				setup: func(fs *flag.FlagSet) func(app *app, args []string) error {
+					timeRange := timeRangeFlags(fs, 24*time.Hour)
+					granularity := granularityFlag(fs)
+					format := fs.String("format", "", "export format: csv or jsonl, by default csv or the --output format")
+					metrics := fs.String("metrics", "bandwidth,volume", "comma separated series to export: bandwidth, volume")
+					outputPath := fs.String("output-file", "", "file to write the export to, stdout by default")
+					return func(app *app, args []string) error {
+						start, end, err := timeRange()
+						if err != nil {
+							return err
+						}
+						if err = granularity().Validate(); err != nil {
+							return usageError{err}
+						}
+						bandwidth, volume, err := parseExportMetrics(*metrics)
+						if err != nil {
+							return usageError{err}
+						}
+						exportFormat, err := exportFormat(*format, &app.output)
+						if err != nil {
+							return usageError{err}
+						}
+						endpointIDs := args
+						if len(endpointIDs) == 0 {
+							resp, endpoints, err := app.client.ListEndpoints(app.ctx)
+							if err != nil {
+								return app.result(resp, nil, err)
+							}
+							if endpoints != nil {
+								for _, endpoint := range *endpoints {
+									endpointIDs = append(endpointIDs, endpoint.EndpointID)
+								}
+							}
+						}
+						out := app.stdout
+						if *outputPath != "" {
+							file, err := os.Create(*outputPath)
+							if err != nil {
+								return err
+							}
+							defer file.Close()
+							out = file
+						}
+						writer, err := export.NewWriter(out, exportFormat)
+						if err != nil {
+							return usageError{err}
+						}
+						exporter := &export.Exporter{
+							Client:      app.client,
+							Writer:      writer,
+							Bandwidth:   bandwidth,
+							Volume:      volume,
+							Granularity: granularity(),
+						}
+						return exporter.Export(app.ctx, endpointIDs, start, end)
+					}
+				},
+			},
+		},
+	}
+}
+
+// exportFormat returns the format of traffic export: --format when given,
+// else the streaming equivalent of --output when given, CSV for csv and JSON
+// Lines for json, else CSV.
+func exportFormat(format string, output *outputFlag) (export.Format, error) {
+	var fromOutput export.Format
+	if output.set {
+		switch output.name() {
+		case "csv":
+			fromOutput = export.FormatCSV
+		case "json":
+			fromOutput = export.FormatJSONLines
+		default:
+			return "", fmt.Errorf("traffic export does not support --output %s, use csv or json", output.name())
+		}
+	}
+	switch {
+	case format == "" && fromOutput == "":
+		return export.FormatCSV, nil
+	case format == "":
+		return fromOutput, nil
+	case fromOutput != "" && export.Format(format) != fromOutput:
+		return "", fmt.Errorf("--format %s conflicts with --output %s", format, output.name())
+	}
+	switch export.Format(format) {
+	case export.FormatCSV, export.FormatJSONLines:
+		return export.Format(format), nil
+	}
+	return "", fmt.Errorf("unknown export format %q, expected csv or jsonl", format)
+}
+
+// parseExportMetrics parses the comma separated --metrics of traffic export.
+func parseExportMetrics(list string) (bandwidth, volume bool, err error) {
+	for _, name := range strings.Split(list, ",") {
+		switch strings.TrimSpace(name) {
+		case "bandwidth":
+			bandwidth = true
+		case "volume":
+			volume = true
+		default:
+			return false, false, fmt.Errorf("invalid --metrics entry %q, expected bandwidth or volume", name)
+		}
+	}
+	return bandwidth, volume, nil
+}
+
+func granularityFlag(fs *flag.FlagSet) func() cdn.Granularity {
+	granularity := fs.String("granularity", string(cdn.GranularityPerHour), "volume granularity: PerFiveMinutes, PerHour or PerDay")
+	return func() cdn.Granularity { return cdn.Granularity(*granularity) }
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestParseExportMetrics(t *testing.T) {
+	tests := []struct {
+		list              string
+		bandwidth, volume bool
+		wantErr           bool
+	}{
+		{"bandwidth,volume", true, true, false},
+		{"bandwidth", true, false, false},
+		{" volume ", false, true, false},
+		{"bandwidth, volume", true, true, false},
+		{"nobandwidth", false, false, true},
+		{"bandwidth,", false, false, true},
+		{"", false, false, true},
+	}
+	for _, tt := range tests {
+		bandwidth, volume, err := parseExportMetrics(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseExportMetrics(%q) error = %v, want error %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (bandwidth != tt.bandwidth || volume != tt.volume) {
+			t.Errorf("parseExportMetrics(%q) = %v, %v, want %v, %v", tt.list, bandwidth, volume, tt.bandwidth, tt.volume)
+		}
+	}
+}
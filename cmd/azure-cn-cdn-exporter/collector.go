@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+// Collector periodically fetches endpoint statistics and keeps the rendered
+// metrics in memory, so scrapes never call the CDN API themselves.
+type Collector struct {
+	Client   *cdn.Client
+	Lookback time.Duration // Range queried for bandwidth and volume
+
+	mu      sync.RWMutex
+	metrics []byte
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+type metric struct {
+	name, help string
+	samples    []sample
+}
+
+// Run refreshes the metrics immediately and then every interval until ctx is
+// done.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh collects all metrics and replaces the cached snapshot.
+func (c *Collector) Refresh(ctx context.Context) {
+	start := time.Now()
+	metrics, err := c.collect(ctx, start)
+	success := 1.0
+	if err != nil {
+		log.Println("collect:", err)
+		success = 0
+	}
+	metrics = append(metrics,
+		metric{"azure_cn_cdn_collect_success", "Whether the last collection succeeded.", []sample{{"", success}}},
+		metric{"azure_cn_cdn_collect_duration_seconds", "Duration of the last collection.", []sample{{"", time.Since(start).Seconds()}}},
+		metric{"azure_cn_cdn_collect_timestamp_seconds", "Unix time of the last collection.", []sample{{"", float64(start.Unix())}}},
+	)
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, s := range m.samples {
+			fmt.Fprintf(&buf, "%s%s %g\n", m.name, s.labels, s.value)
+		}
+	}
+	c.mu.Lock()
+	c.metrics = buf.Bytes()
+	c.mu.Unlock()
+}
+
+// WriteTo writes the cached metrics in the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, err := w.Write(c.metrics)
+	return int64(n), err
+}
+
+func (c *Collector) collect(ctx context.Context, now time.Time) ([]metric, error) {
+	_, endpoints, err := c.Client.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		bandwidth       = metric{name: "azure_cn_cdn_bandwidth_mbps", help: "Latest CDN bandwidth in Mbps."}
+		originBandwidth = metric{name: "azure_cn_cdn_origin_bandwidth_mbps", help: "Latest return-to-source bandwidth in Mbps."}
+		volume          = metric{name: "azure_cn_cdn_volume_megabytes", help: "CDN traffic over the lookback window in MB."}
+		originVolume    = metric{name: "azure_cn_cdn_origin_volume_megabytes", help: "Return-to-source traffic over the lookback window in MB."}
+		offload         = metric{name: "azure_cn_cdn_origin_offload_ratio", help: "Share of CDN traffic served without going back to source."}
+		enabled         = metric{name: "azure_cn_cdn_endpoint_enabled", help: "Whether the endpoint is enabled."}
+		cname           = metric{name: "azure_cn_cdn_endpoint_cname_configured", help: "Whether the CNAME of the endpoint is configured."}
+		icp             = metric{name: "azure_cn_cdn_endpoint_icp_verify_status", help: "ICP verification status of the endpoint, 1 for the current status."}
+		collectErrors   = metric{name: "azure_cn_cdn_endpoint_collect_errors", help: "Number of failed statistic requests for the endpoint in the last collection."}
+		firstErr        error
+	)
+	if endpoints != nil {
+		for _, endpoint := range *endpoints {
+			labels := fmt.Sprintf(`{endpoint_id="%s",custom_domain="%s",service_type="%s"}`,
+				escapeLabel(endpoint.EndpointID), escapeLabel(endpoint.Settings.CustomDomain), escapeLabel(endpoint.Settings.ServiceType))
+			enabled.samples = append(enabled.samples, sample{labels, boolValue(endpoint.Status.Enabled)})
+			cname.samples = append(cname.samples, sample{labels, boolValue(endpoint.Status.CNameConfigured)})
+			icp.samples = append(icp.samples, sample{
+				strings.TrimSuffix(labels, "}") + fmt.Sprintf(`,status="%s"}`, escapeLabel(endpoint.Status.ICPVerifyStatus)), 1})
+
+			var failures float64
+			// The Query methods split a long lookback into several requests.
+			b, err := c.Client.QueryBandwidth(ctx, &cdn.GetEndpointBandwidthRequest{
+				EndpointId: endpoint.EndpointID,
+				StartTime:  now.Add(-c.Lookback),
+				EndTime:    now,
+			})
+			if err == nil && len(b.Items) > 0 {
+				latest := b.Items[len(b.Items)-1] // Items are sorted by time
+				bandwidth.samples = append(bandwidth.samples, sample{labels, float64(latest.BandwidthInMbps)})
+				originBandwidth.samples = append(originBandwidth.samples, sample{labels, float64(latest.OriginBandwidthInMbps)})
+			} else if err != nil {
+				failures++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("bandwidth of %s: %w", endpoint.EndpointID, err)
+				}
+			}
+
+			v, err := c.Client.QueryVolume(ctx, &cdn.GetEndpointVolumeRequest{
+				EndpointID:  endpoint.EndpointID,
+				Granularity: cdn.GranularityPerFiveMinutes,
+				StartTime:   now.Add(-c.Lookback),
+				EndTime:     now,
+			})
+			if err == nil {
+				volume.samples = append(volume.samples, sample{labels, float64(v.TotalCDNVolumeInMB)})
+				originVolume.samples = append(originVolume.samples, sample{labels, float64(v.TotalOriginVolumeInMB)})
+				if v.TotalCDNVolumeInMB > 0 {
+					offload.samples = append(offload.samples, sample{labels,
+						1 - float64(v.TotalOriginVolumeInMB)/float64(v.TotalCDNVolumeInMB)})
+				}
+			} else if err != nil {
+				failures++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("volume of %s: %w", endpoint.EndpointID, err)
+				}
+			}
+			collectErrors.samples = append(collectErrors.samples, sample{labels, failures})
+		}
+	}
+	metrics := []metric{bandwidth, originBandwidth, volume, originVolume, offload, enabled, cname, icp, collectErrors}
+	for _, m := range metrics {
+		sort.Slice(m.samples, func(i, j int) bool { return m.samples[i].labels < m.samples[j].labels })
+	}
+	return metrics, firstErr
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// WriteOperationMetrics writes the API call metrics of the exporter itself
+// in the Prometheus text format.
+func WriteOperationMetrics(w io.Writer, stats []cdn.OperationStats) error {
+	var buf bytes.Buffer
+	buf.WriteString("# HELP azure_cn_cdn_api_requests_total CDN API calls made by the exporter.\n# TYPE azure_cn_cdn_api_requests_total counter\n")
+	for _, s := range stats {
+		fmt.Fprintf(&buf, "azure_cn_cdn_api_requests_total{operation=\"%s\"} %d\n", escapeLabel(s.Operation), s.Count)
+	}
+	buf.WriteString("# HELP azure_cn_cdn_api_errors_total Failed CDN API calls made by the exporter.\n# TYPE azure_cn_cdn_api_errors_total counter\n")
+	for _, s := range stats {
+		types := make([]string, 0, len(s.ErrorTypes))
+		for t := range s.ErrorTypes {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Fprintf(&buf, "azure_cn_cdn_api_errors_total{operation=\"%s\",error_type=\"%s\"} %d\n", escapeLabel(s.Operation), escapeLabel(t), s.ErrorTypes[t])
+		}
+	}
+	buf.WriteString("# HELP azure_cn_cdn_api_request_duration_seconds Latency of CDN API calls made by the exporter.\n# TYPE azure_cn_cdn_api_request_duration_seconds histogram\n")
+	for _, s := range stats {
+		op := escapeLabel(s.Operation)
+		for i, bound := range cdn.LatencyBuckets {
+			fmt.Fprintf(&buf, "azure_cn_cdn_api_request_duration_seconds_bucket{operation=\"%s\",le=\"%g\"} %d\n", op, bound.Seconds(), s.LatencyCount[i])
+		}
+		fmt.Fprintf(&buf, "azure_cn_cdn_api_request_duration_seconds_bucket{operation=\"%s\",le=\"+Inf\"} %d\n", op, s.Count)
+		fmt.Fprintf(&buf, "azure_cn_cdn_api_request_duration_seconds_sum{operation=\"%s\"} %g\n", op, s.LatencySum.Seconds())
+		fmt.Fprintf(&buf, "azure_cn_cdn_api_request_duration_seconds_count{operation=\"%s\"} %d\n", op, s.Count)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func TestCollectorLatestBandwidth(t *testing.T) {
+	// Items outside the lookback window are dropped, so they are relative to
+	// the current time.
+	base := time.Now().UTC().Truncate(5 * time.Minute)
+	at := func(ago time.Duration) string { return base.Add(-ago).Format(time.RFC3339) }
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/endpoints"):
+			fmt.Fprint(w, `[{"EndpointID": "ep-1", "Settings": {"CustomDomain": "a.example.com"}}]`)
+		case strings.HasSuffix(r.URL.Path, "/bandwidth"):
+			fmt.Fprintf(w, `{"Items": [
+				{"Timestamp": %q, "BandwidthInMbps": 30, "OriginBandwidthInMbps": 3},
+				{"Timestamp": %q, "BandwidthInMbps": 10, "OriginBandwidthInMbps": 1},
+				{"Timestamp": %q, "BandwidthInMbps": 20, "OriginBandwidthInMbps": 2}
+			]}`, at(0), at(10*time.Minute), at(5*time.Minute))
+		case strings.HasSuffix(r.URL.Path, "/volume"):
+			fmt.Fprintf(w, `{"Items": [
+				{"Timestamp": %q, "VolumeInMB": 60, "OriginVolumeInMB": 20},
+				{"Timestamp": %q, "VolumeInMB": 40, "OriginVolumeInMB": 5}
+			], "TotalCDNVolumeInMB": 100, "TotalOriginVolumeInMB": 25}`, at(5*time.Minute), at(10*time.Minute))
+		}
+	}))
+	defer srv.Close()
+
+	client := cdn.NewClient("id", "key", "sub")
+	client.HTTPClient = srv.Client()
+	client.RestAPIEndpoint = srv.Listener.Addr().String()
+	collector := &Collector{Client: client, Lookback: 30 * time.Minute}
+	collector.Refresh(context.Background())
+	var buf bytes.Buffer
+	if _, err := collector.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	labels := `{endpoint_id="ep-1",custom_domain="a.example.com",service_type=""}`
+	for _, want := range []string{
+		"azure_cn_cdn_bandwidth_mbps" + labels + " 30\n",
+		"azure_cn_cdn_origin_bandwidth_mbps" + labels + " 3\n",
+		"azure_cn_cdn_origin_offload_ratio" + labels + " 0.75\n",
+		"azure_cn_cdn_endpoint_collect_errors" + labels + " 0\n",
+		"azure_cn_cdn_collect_success 1\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics miss %q:\n%s", want, buf.String())
+		}
+	}
+}
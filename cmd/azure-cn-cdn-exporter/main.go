@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fdkevin0/azure-cn/cdn"
+)
+
+func main() {
+	listen := flag.String("listen", ":9870", "address to serve /metrics on")
+	interval := flag.Duration("interval", 5*time.Minute, "how often to refresh the metrics from the CDN API")
+	lookback := flag.Duration("lookback", 30*time.Minute, "time range queried for bandwidth and volume, long ranges take several requests")
+	credentialsFile := flag.String("credentials-file", "", "JSON file with KeyID and KeyValue, reloaded when it changes")
+	credentialProcess := flag.String("credential-process", "", "command printing KeyID, KeyValue and an optional Expiration as JSON")
+	flag.Parse()
+	if *interval <= 0 || *lookback <= 0 {
+		fmt.Fprintln(os.Stderr, "-interval and -lookback must be positive")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	apiMetrics := &cdn.OperationMetrics{}
+	client := cdn.NewClient(
+		os.Getenv("AZURE_CN_CDN_KEY_ID"),
+		os.Getenv("AZURE_CN_CDN_KEY_VALUE"),
+		os.Getenv("AZURE_CN_SUBSCRIPTION_ID"),
+		cdn.WithUserAgent("azure-cn-cdn-exporter"),
+		cdn.WithInstrumentation(apiMetrics),
+	)
+	switch {
+	case *credentialsFile != "" && *credentialProcess != "":
+		log.Fatal("-credentials-file and -credential-process are mutually exclusive")
+	case *credentialsFile != "":
+		credentials, err := cdn.NewFileCredentials(*credentialsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		credentials.OnRefreshError = logRefreshError
+		client.Credentials = credentials
+	case *credentialProcess != "":
+		client.Credentials = &cdn.ProcessCredentials{
+			Command:        strings.Fields(*credentialProcess),
+			ExpiryWindow:   time.Minute,
+			OnRefreshError: logRefreshError,
+		}
+	}
+	collector := &Collector{
+		Client:   client,
+		Lookback: *lookback,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go collector.Run(ctx, *interval)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = collector.WriteTo(w)
+		_ = WriteOperationMetrics(w, apiMetrics.Snapshot())
+	})
+	server := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	log.Println("Listening on", *listen)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+func logRefreshError(err error) {
+	log.Println("Keeping the previous keys:", err)
+}